@@ -9,10 +9,18 @@
 package galf
 
 import (
+	"context"
 	"math"
+	"math/rand"
+	"sync"
 	"time"
 )
 
+const (
+	DefaultBackoffBase = 100 * time.Millisecond
+	DefaultBackoffCap  = 10 * time.Second
+)
+
 // BackoffStrategy is used to determine how long a retry request should wait until attempted
 type BackoffStrategy func(retry int) time.Duration
 
@@ -31,3 +39,151 @@ func ExponentialBackoff(i int) time.Duration {
 func LinearBackoff(i int) time.Duration {
 	return time.Duration(i) * time.Second
 }
+
+// BackoffBuilder composes capped exponential backoffs, with or without jitter.
+// Jitter spreads the retries of many clients failing at the same moment, e.g.
+// against the token endpoint after an outage, instead of having them retry in step.
+type BackoffBuilder struct {
+	base   time.Duration
+	cap    time.Duration
+	source rand.Source
+}
+
+// NewBackoffBuilder starts from DefaultBackoffBase and DefaultBackoffCap,
+// with a time-seeded random source
+func NewBackoffBuilder() *BackoffBuilder {
+	return &BackoffBuilder{
+		base: DefaultBackoffBase,
+		cap:  DefaultBackoffCap,
+	}
+}
+
+// Base sets the backoff of the first retry
+func (b *BackoffBuilder) Base(base time.Duration) *BackoffBuilder {
+	b.base = base
+	return b
+}
+
+// Cap sets the longest backoff returned
+func (b *BackoffBuilder) Cap(ceiling time.Duration) *BackoffBuilder {
+	b.cap = ceiling
+	return b
+}
+
+// Source sets the random source of the jitter, e.g. a seeded one in tests
+func (b *BackoffBuilder) Source(source rand.Source) *BackoffBuilder {
+	b.source = source
+	return b
+}
+
+// Exponential doubles the backoff on every retry, without jitter
+func (b *BackoffBuilder) Exponential() BackoffStrategy {
+	base, ceiling := b.base, b.cap
+	return func(retry int) time.Duration {
+		return cappedExponential(base, ceiling, retry)
+	}
+}
+
+// FullJitter picks a random backoff between zero and the exponential one
+func (b *BackoffBuilder) FullJitter() BackoffStrategy {
+	base, ceiling, random := b.base, b.cap, newLockedRand(b.source)
+	return func(retry int) time.Duration {
+		return random.duration(cappedExponential(base, ceiling, retry) + 1)
+	}
+}
+
+// EqualJitter keeps half of the exponential backoff and randomizes the other half
+func (b *BackoffBuilder) EqualJitter() BackoffStrategy {
+	base, ceiling, random := b.base, b.cap, newLockedRand(b.source)
+	return func(retry int) time.Duration {
+		half := cappedExponential(base, ceiling, retry) / 2
+		return half + random.duration(half+1)
+	}
+}
+
+// DecorrelatedJitter picks a random backoff between base and base * 3^retry,
+// at most cap: the largest value the previous backoff allows. The bound only
+// depends on retry, so concurrent callers sharing the strategy do not
+// influence each other.
+func (b *BackoffBuilder) DecorrelatedJitter() BackoffStrategy {
+	base, ceiling, random := b.base, b.cap, newLockedRand(b.source)
+
+	return func(retry int) time.Duration {
+		upper := base
+		for i := 0; i < retry && upper < ceiling; i++ {
+			upper *= 3
+		}
+		if upper > ceiling {
+			upper = ceiling
+		}
+		if upper < base {
+			upper = base
+		}
+
+		return base + random.duration(upper-base+1)
+	}
+}
+
+// cappedExponential returns base * 2^(retry-1), at most ceiling
+func cappedExponential(base time.Duration, ceiling time.Duration, retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	if base <= 0 {
+		return 0
+	}
+
+	backoff := base
+	for i := 1; i < retry; i++ {
+		if backoff >= ceiling/2 {
+			return ceiling
+		}
+		backoff *= 2
+	}
+	if backoff > ceiling {
+		return ceiling
+	}
+	return backoff
+}
+
+// lockedRand makes a rand.Source, which is not safe for concurrent use,
+// usable from a BackoffStrategy shared between goroutines
+type lockedRand struct {
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+func newLockedRand(source rand.Source) *lockedRand {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	return &lockedRand{random: rand.New(source)}
+}
+
+// duration returns a random duration in [0, n)
+func (r *lockedRand) duration(n time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return time.Duration(r.random.Int63n(int64(n)))
+}
+
+// sleep waits for d, returning early with the context error if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
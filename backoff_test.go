@@ -0,0 +1,84 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"math/rand"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type backoffSuite struct{}
+
+var _ = check.Suite(&backoffSuite{})
+
+func (s *backoffSuite) TestExponential(c *check.C) {
+	backoff := NewBackoffBuilder().Base(100 * time.Millisecond).Cap(time.Second).Exponential()
+
+	c.Assert(backoff(1), check.Equals, 100*time.Millisecond)
+	c.Assert(backoff(2), check.Equals, 200*time.Millisecond)
+	c.Assert(backoff(4), check.Equals, 800*time.Millisecond)
+	c.Assert(backoff(5), check.Equals, time.Second)
+	c.Assert(backoff(1000), check.Equals, time.Second)
+}
+
+func (s *backoffSuite) TestFullJitter(c *check.C) {
+	backoff := NewBackoffBuilder().Base(100 * time.Millisecond).Cap(time.Second).Source(rand.NewSource(1)).FullJitter()
+
+	for retry := 1; retry <= 10; retry++ {
+		d := backoff(retry)
+		c.Assert(d >= 0, check.Equals, true)
+		c.Assert(d <= cappedExponential(100*time.Millisecond, time.Second, retry), check.Equals, true)
+	}
+}
+
+func (s *backoffSuite) TestEqualJitter(c *check.C) {
+	backoff := NewBackoffBuilder().Base(100 * time.Millisecond).Cap(time.Second).Source(rand.NewSource(1)).EqualJitter()
+
+	for retry := 1; retry <= 10; retry++ {
+		d := backoff(retry)
+		exponential := cappedExponential(100*time.Millisecond, time.Second, retry)
+		c.Assert(d >= exponential/2, check.Equals, true)
+		c.Assert(d <= exponential, check.Equals, true)
+	}
+}
+
+func (s *backoffSuite) TestDecorrelatedJitter(c *check.C) {
+	backoff := NewBackoffBuilder().Base(100 * time.Millisecond).Cap(time.Second).Source(rand.NewSource(1)).DecorrelatedJitter()
+
+	upper := 100 * time.Millisecond
+	for retry := 1; retry <= 10; retry++ {
+		upper *= 3
+		if upper > time.Second {
+			upper = time.Second
+		}
+
+		d := backoff(retry)
+		c.Assert(d >= 100*time.Millisecond, check.Equals, true)
+		c.Assert(d <= upper, check.Equals, true)
+	}
+
+	// another caller retrying does not change the bound of the first retry
+	for i := 0; i < 10; i++ {
+		backoff(5)
+		c.Assert(backoff(1) <= 300*time.Millisecond, check.Equals, true)
+	}
+}
+
+func (s *backoffSuite) TestSeededSourceIsDeterministic(c *check.C) {
+	builder := NewBackoffBuilder().Source(rand.NewSource(42))
+	first := builder.FullJitter()
+	builder.Source(rand.NewSource(42))
+	second := builder.FullJitter()
+
+	for retry := 1; retry <= 5; retry++ {
+		c.Assert(first(retry), check.Equals, second(retry))
+	}
+}
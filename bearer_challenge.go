@@ -0,0 +1,142 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Error codes of a Bearer challenge (RFC 6750 3.1)
+const (
+	BearerInvalidRequest    = "invalid_request"
+	BearerInvalidToken      = "invalid_token"
+	BearerInsufficientScope = "insufficient_scope"
+)
+
+// BearerChallenge is the Bearer challenge of a WWW-Authenticate header (RFC 6750 3)
+type BearerChallenge struct {
+	Realm            string
+	Scope            string
+	Error            string
+	ErrorDescription string
+	ErrorURI         string
+}
+
+// ParseBearerChallenge returns the Bearer challenge of the WWW-Authenticate
+// headers, nil when there is none
+func ParseBearerChallenge(header http.Header) *BearerChallenge {
+	for _, value := range header[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		if challenge := parseBearerChallenge(value); challenge != nil {
+			return challenge
+		}
+	}
+	return nil
+}
+
+// Scopes returns the scopes the challenge requires
+func (bc *BearerChallenge) Scopes() []string {
+	return strings.Fields(bc.Scope)
+}
+
+// refreshMayHelp reports whether a new token could get the request accepted:
+// only an expired or otherwise invalid token is fixed by renewing it, a
+// malformed request or a missing scope fails the same way with any token
+func (bc *BearerChallenge) refreshMayHelp() bool {
+	return bc == nil || bc.Error == "" || bc.Error == BearerInvalidToken
+}
+
+func (bc *BearerChallenge) set(name string, value string) {
+	switch strings.ToLower(name) {
+	case "realm":
+		bc.Realm = value
+	case "scope":
+		bc.Scope = value
+	case "error":
+		bc.Error = value
+	case "error_description":
+		bc.ErrorDescription = value
+	case "error_uri":
+		bc.ErrorURI = value
+	}
+}
+
+// parseBearerChallenge parses a header value holding one or more challenges,
+// e.g. `Basic realm="api", Bearer error="invalid_token"` (RFC 7235 4.1)
+func parseBearerChallenge(value string) *BearerChallenge {
+	var challenge *BearerChallenge
+	var inBearer bool
+
+	s := value
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return challenge
+		}
+
+		var name string
+		if name, s = readToken(s); name == "" {
+			// skip what is neither a scheme nor a parameter, e.g. token68 padding
+			s = s[1:]
+			continue
+		}
+
+		s = strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(s, "=") {
+			// a new challenge; only the first Bearer one is kept
+			inBearer = strings.EqualFold(name, "Bearer") && challenge == nil
+			if inBearer {
+				challenge = &BearerChallenge{}
+			}
+			continue
+		}
+
+		var param string
+		param, s = readParamValue(strings.TrimLeft(s[1:], " \t"))
+		if inBearer {
+			challenge.set(name, param)
+		}
+	}
+}
+
+func readToken(s string) (string, string) {
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func readParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		return readToken(s)
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return value.String(), s[i+1:]
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+		}
+		value.WriteByte(s[i])
+	}
+	return value.String(), ""
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
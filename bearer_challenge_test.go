@@ -0,0 +1,115 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"gopkg.in/check.v1"
+)
+
+type bearerChallengeSuite struct{}
+
+var _ = check.Suite(&bearerChallengeSuite{})
+
+func (s *bearerChallengeSuite) TestParseBearerChallenge(c *check.C) {
+	header := http.Header{}
+	header.Set("WWW-Authenticate", `Bearer realm="example", error="insufficient_scope", error_description="The \"feed\" scope is required", scope="feed:read feed:write"`)
+
+	challenge := ParseBearerChallenge(header)
+	c.Assert(challenge, check.DeepEquals, &BearerChallenge{
+		Realm:            "example",
+		Scope:            "feed:read feed:write",
+		Error:            BearerInsufficientScope,
+		ErrorDescription: `The "feed" scope is required`,
+	})
+	c.Assert(challenge.Scopes(), check.DeepEquals, []string{"feed:read", "feed:write"})
+}
+
+func (s *bearerChallengeSuite) TestParseBearerChallengeAmongOthers(c *check.C) {
+	header := http.Header{}
+	header.Add("WWW-Authenticate", `Negotiate YWJjZA==`)
+	header.Add("WWW-Authenticate", `Basic realm="basic", Bearer error=invalid_token,error_uri="https://example.com/errors", Bearer error="invalid_request"`)
+
+	challenge := ParseBearerChallenge(header)
+	c.Assert(challenge, check.DeepEquals, &BearerChallenge{
+		Error:    BearerInvalidToken,
+		ErrorURI: "https://example.com/errors",
+	})
+
+	c.Assert(ParseBearerChallenge(http.Header{}), check.IsNil)
+	c.Assert(ParseBearerChallenge(http.Header{"Www-Authenticate": {`Basic realm="basic"`}}), check.IsNil)
+	c.Assert(ParseBearerChallenge(http.Header{"Www-Authenticate": {`bearer`}}), check.DeepEquals, &BearerChallenge{})
+}
+
+func (s *bearerChallengeSuite) TestRefreshMayHelp(c *check.C) {
+	c.Assert((*BearerChallenge)(nil).refreshMayHelp(), check.Equals, true)
+	c.Assert((&BearerChallenge{}).refreshMayHelp(), check.Equals, true)
+	c.Assert((&BearerChallenge{Error: BearerInvalidToken}).refreshMayHelp(), check.Equals, true)
+	c.Assert((&BearerChallenge{Error: BearerInsufficientScope}).refreshMayHelp(), check.Equals, false)
+	c.Assert((&BearerChallenge{Error: BearerInvalidRequest}).refreshMayHelp(), check.Equals, false)
+}
+
+func handleChallenge(requests *int32, challenge string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("WWW-Authenticate", challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func (s *bearerChallengeSuite) TestClientRefreshesInvalidToken(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleChallenge(&requests, `Bearer error="invalid_token", error_description="The access token expired"`))
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	options := defaultClientOptions
+	options.MaxRetries = 3
+	resp, err := NewClientCustom(tm, options).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(2))
+}
+
+func (s *bearerChallengeSuite) TestClientDoesNotRefreshInsufficientScope(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleChallenge(&requests, `Bearer error="insufficient_scope", scope="feed:write"`))
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	options := defaultClientOptions
+	options.MaxRetries = 3
+	options.ErrorStatuses = NonSuccessStatuses
+	resp, err := NewClientCustom(tm, options).Get(ts.URL + "/feed/1")
+	c.Assert(resp, check.IsNil)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(0))
+
+	var statusErr *StatusError
+	c.Assert(errors.As(err, &statusErr), check.Equals, true)
+	c.Assert(statusErr.Challenge.Error, check.Equals, BearerInsufficientScope)
+	c.Assert(statusErr.Challenge.Scopes(), check.DeepEquals, []string{"feed:write"})
+}
+
+func (s *bearerChallengeSuite) TestClientDoesNotRefreshInvalidRequest(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleChallenge(&requests, `Bearer error="invalid_request"`))
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	resp, err := NewClientCustom(tm, defaultClientOptions).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(0))
+}
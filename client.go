@@ -10,14 +10,12 @@ package galf
 
 import (
 	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 	"io"
 	"net/http"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
-	"github.com/facebookgo/stackerr"
 	"github.com/globocom/goreq"
 )
 
@@ -26,7 +24,11 @@ type (
 		TokenManager TokenManager
 		Options      ClientOptions
 		clientHTTP   goreq.Client
+		httpClient   *http.Client
 	}
+
+	// sendFunc sends a single request authorized with token
+	sendFunc func(ctx context.Context, token *Token) (*http.Response, error)
 )
 
 func init() {}
@@ -45,94 +47,265 @@ func NewClientCustom(tokenManager TokenManager, options ClientOptions) *Client {
 		Options:      options,
 		clientHTTP: goreq.NewClient(goreq.Options{
 			Timeout:             options.Timeout,
-			MaxIdleConnsPerHost: 250,
+			MaxIdleConnsPerHost: DefaultClientMaxIdleConnsPerHost,
 		}),
+		httpClient: options.newHTTPClient(),
 	}
 }
 
 func (c *Client) Get(url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
-	return c.retry(http.MethodGet, url, nil, reqOptions...)
+	return c.retry(context.Background(), http.MethodGet, url, nil, reqOptions...)
 }
 
 func (c *Client) Post(url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
-	return c.retry(http.MethodPost, url, body, reqOptions...)
+	return c.retry(context.Background(), http.MethodPost, url, body, reqOptions...)
 }
 
 func (c *Client) Put(url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
-	return c.retry(http.MethodPut, url, body, reqOptions...)
+	return c.retry(context.Background(), http.MethodPut, url, body, reqOptions...)
 }
 
 func (c *Client) Delete(url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
-	return c.retry(http.MethodDelete, url, nil, reqOptions...)
+	return c.retry(context.Background(), http.MethodDelete, url, nil, reqOptions...)
 }
 
-func (c *Client) retry(method string, url string, body interface{}, reqOptions ...*requestOptions) (resp *goreq.Response, err error) {
+func (c *Client) Patch(url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(context.Background(), http.MethodPatch, url, body, reqOptions...)
+}
 
-	if c.TokenManager == nil {
-		return nil, errors.New("Configure tokenManager or SetDefaultTokenManager")
-	}
+func (c *Client) Head(url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(context.Background(), http.MethodHead, url, nil, reqOptions...)
+}
+
+// OptionsRequest sends an OPTIONS request; the name avoids clashing with the Options field
+func (c *Client) OptionsRequest(url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(context.Background(), http.MethodOptions, url, nil, reqOptions...)
+}
+
+// Do sends a request with an arbitrary HTTP method, with the same token
+// injection, retries and circuit breaker as the other methods
+func (c *Client) Do(method string, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(context.Background(), method, url, body, reqOptions...)
+}
+
+func (c *Client) GetContext(ctx context.Context, url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodGet, url, nil, reqOptions...)
+}
+
+func (c *Client) PostContext(ctx context.Context, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodPost, url, body, reqOptions...)
+}
+
+func (c *Client) PutContext(ctx context.Context, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodPut, url, body, reqOptions...)
+}
+
+func (c *Client) DeleteContext(ctx context.Context, url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodDelete, url, nil, reqOptions...)
+}
+
+func (c *Client) PatchContext(ctx context.Context, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodPatch, url, body, reqOptions...)
+}
+
+func (c *Client) HeadContext(ctx context.Context, url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodHead, url, nil, reqOptions...)
+}
+
+func (c *Client) OptionsRequestContext(ctx context.Context, url string, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, http.MethodOptions, url, nil, reqOptions...)
+}
+
+func (c *Client) DoContext(ctx context.Context, method string, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
+	return c.retry(ctx, method, url, body, reqOptions...)
+}
+
+func (c *Client) retry(ctx context.Context, method string, url string, body interface{}, reqOptions ...*requestOptions) (*goreq.Response, error) {
 
 	var reqOption *requestOptions
 	if len(reqOptions) > 0 {
 		reqOption = reqOptions[0]
 	}
 
-	var originalBody []byte
-	if originalBody, err = copyBody(body); err != nil {
+	// failing beats sending the request without the client certificate
+	if c.Options.TLSConfig != nil {
+		return nil, &ConfigError{Message: "TLSConfig is only supported by DoRequest, GetJSON and PostJSON"}
+	}
+
+	originalBody, err := copyBody(body, c.getContentType(reqOption))
+	if err != nil {
 		return nil, err
 	}
 
-	var bodyReader io.Reader
-	for i := 1; i <= c.Options.MaxRetries; i++ {
+	// goreq responses are not bound to the context, so it can end with the call
+	ctx, cancel := c.withTotalTimeout(ctx)
+	defer cancel()
 
+	var resp *goreq.Response
+	_, err = c.execute(ctx, method, reqOption, func(ctx context.Context, token *Token) (*http.Response, error) {
+		var bodyReader io.Reader
 		if len(originalBody) > 0 {
 			bodyReader = bytes.NewBuffer(originalBody)
 		}
 
-		if resp, err = c.do(method, url, bodyReader, reqOption); err != nil {
+		var err error
+		if resp, err = c.request(ctx, token.Authorization, method, url, bodyReader, reqOption); err != nil {
 			return nil, err
 		}
+		return resp.Response, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// execute runs send until it gets a response that is not worth retrying or
+// runs out of retries, backing off between attempts. A 401 renews the token,
+// unless its Bearer challenge shows a new token would not help; other
+// failures are retried as allowed by the RetryPolicy.
+func (c *Client) execute(ctx context.Context, method string, reqOption *requestOptions, send sendFunc) (resp *http.Response, err error) {
 
-		if resp.StatusCode != http.StatusUnauthorized {
-			return resp, nil
+	if c.TokenManager == nil {
+		return nil, &ConfigError{Message: "Configure tokenManager or SetDefaultTokenManager"}
+	}
+
+	if c.Options.RetryBudget != nil {
+		c.Options.RetryBudget.deposit()
+	}
+
+	var attempts int
+	var exhausted bool
+	for attempts = 1; ; attempts++ {
+
+		resp, err = c.do(ctx, reqOption, send)
+		if !c.shouldRetry(ctx, method, resp, err) {
+			break
+		}
+		if attempts >= c.Options.maxAttempts() || (c.Options.RetryBudget != nil && !c.Options.RetryBudget.withdraw()) {
+			exhausted = true
+			break
 		}
 
-		if i < c.Options.MaxRetries {
-			c.TokenManager.ResetToken()
-			time.Sleep(c.Options.Backoff(i))
+		var retryAfter time.Duration
+		var hasRetryAfter bool
+		if resp != nil {
+			resp.Body.Close() // nolint:errcheck
+			if resp.StatusCode == http.StatusUnauthorized {
+				c.resetToken(reqOption)
+			}
+			retryAfter, hasRetryAfter = parseRetryAfter(resp.Header, time.Now())
+		}
+
+		wait := retryWait(c.Options.backoff(attempts), retryAfter, hasRetryAfter, c.Options.MaxRetryAfter)
+		if err = sleep(ctx, wait); err != nil {
+			return nil, err
 		}
 	}
 
-	return resp, err
+	if err == nil && resp != nil && c.Options.isErrorStatus(resp.StatusCode) {
+		err = newStatusError(resp.StatusCode, resp.Header, resp.Body, c.Options.maxErrorBodySize())
+	}
+
+	if err != nil {
+		if exhausted {
+			exhaustedErr := &RetriesExhaustedError{Attempts: attempts, Err: err}
+			if resp != nil {
+				exhaustedErr.StatusCode = resp.StatusCode
+				exhaustedErr.RetryAfter, _ = parseRetryAfter(resp.Header, time.Now())
+			}
+			return nil, exhaustedErr
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// withTotalTimeout bounds ctx by TotalTimeout, if set
+func (c *Client) withTotalTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Options.TotalTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.Options.TotalTimeout)
+}
+
+func (c *Client) shouldRetry(ctx context.Context, method string, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return c.Options.RetryPolicy != nil && c.Options.RetryPolicy.retryError(method, err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ParseBearerChallenge(resp.Header).refreshMayHelp()
+	}
+	return c.Options.RetryPolicy != nil && c.Options.RetryPolicy.retryStatus(method, resp.StatusCode)
 }
 
-func (c *Client) do(method string, url string, body interface{}, reqOption *requestOptions) (*goreq.Response, error) {
+func (c *Client) do(ctx context.Context, reqOption *requestOptions, send sendFunc) (*http.Response, error) {
 
-	token, err := c.TokenManager.GetToken()
+	token, err := c.getToken(ctx, reqOption)
 	if err != nil {
 		return nil, err
 	}
 
 	if c.Options.HystrixConfig == nil {
-		return c.request(token.Authorization, method, url, body, reqOption)
+		return send(ctx, token)
 	}
 
 	if err := c.Options.HystrixConfig.valid(); err != nil {
 		return nil, err
 	}
-	return c.requestHystrix(token.Authorization, method, url, body, reqOption)
+	return c.requestHystrix(ctx, token, send)
 }
 
-func (c *Client) requestHystrix(authorization string, method string, url string, body interface{}, reqOption *requestOptions) (*goreq.Response, error) {
+func (c *Client) getToken(ctx context.Context, reqOption *requestOptions) (*Token, error) {
+	if reqOption != nil && len(reqOption.scopes) > 0 {
+		tm, ok := c.TokenManager.(ScopedTokenManager)
+		if !ok {
+			return nil, &ConfigError{Message: "TokenManager does not support request scopes"}
+		}
+		return tm.GetScopedTokenContext(ctx, reqOption.scopes)
+	}
+
+	if tm, ok := c.TokenManager.(ContextTokenManager); ok {
+		return tm.GetTokenContext(ctx)
+	}
+	return c.TokenManager.GetToken()
+}
+
+func (c *Client) resetToken(reqOption *requestOptions) {
+	if reqOption != nil && len(reqOption.scopes) > 0 {
+		if tm, ok := c.TokenManager.(ScopedTokenManager); ok {
+			tm.ResetScopedToken(reqOption.scopes)
+			return
+		}
+	}
+	c.TokenManager.ResetToken()
+}
+
+func (c *Client) requestHystrix(ctx context.Context, token *Token, send sendFunc) (*http.Response, error) {
+
+	output := make(chan *http.Response)
+	// closed once we stop waiting, so a late response is closed instead of
+	// leaking its connection
+	abandoned := make(chan struct{})
+	defer close(abandoned)
 
-	output := make(chan *goreq.Response, 1)
 	errors := hystrix.Go(c.Options.HystrixConfig.Name, func() error {
 
-		resp, err := c.request(authorization, method, url, body, reqOption)
+		resp, err := send(ctx, token)
 		if err != nil {
 			return err
 		}
-		output <- resp
+		select {
+		case output <- resp:
+		case <-abandoned:
+			resp.Body.Close() // nolint:errcheck
+		}
 
 		return nil
 
@@ -142,14 +315,16 @@ func (c *Client) requestHystrix(authorization string, method string, url string,
 	case out := <-output:
 		return out, nil
 	case err := <-errors:
-		return nil, err
+		return nil, c.Options.HystrixConfig.circuitError(err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-func (c *Client) request(authorization string, method string, url string, body interface{}, reqOption *requestOptions) (*goreq.Response, error) {
+func (c *Client) request(ctx context.Context, authorization string, method string, url string, body interface{}, reqOption *requestOptions) (*goreq.Response, error) {
 	req := goreq.Request{
 		Method:      method,
-		ContentType: c.getContentType(),
+		ContentType: c.getContentType(reqOption),
 		Uri:         url,
 		Body:        body,
 		ShowDebug:   c.Options.ShowDebug,
@@ -162,16 +337,51 @@ func (c *Client) request(authorization string, method string, url string, body i
 		}
 	}
 
-	resp, err := c.clientHTTP.Do(req)
+	if ctx.Done() == nil {
+		return c.send(req)
+	}
 
-	if err != nil {
-		return nil, stackerr.Wrap(err)
+	// goreq requests cannot be canceled, so the caller stops waiting on it
+	// instead and the late response, if any, is discarded
+	type result struct {
+		resp *goreq.Response
+		err  error
 	}
+	output := make(chan result, 1)
+	go func() {
+		resp, err := c.send(req)
+		output <- result{resp, err}
+	}()
 
-	return resp, nil
+	select {
+	case out := <-output:
+		return out.resp, out.err
+	case <-ctx.Done():
+		go func() {
+			if out := <-output; out.resp != nil {
+				out.resp.Body.Close() // nolint:errcheck
+			}
+		}()
+		return nil, ctx.Err()
+	}
 }
 
-func (c *Client) getContentType() (contentType string) {
+func (c *Client) send(req goreq.Request) (*goreq.Response, error) {
+	resp, err := c.clientHTTP.Do(req)
+
+	// goreq.Error has no Unwrap, which would hide its cause from the
+	// RetryPolicy and from callers using errors.Is and errors.As
+	if goreqErr, ok := err.(*goreq.Error); ok && goreqErr.Err != nil {
+		return resp, goreqErr.Err
+	}
+	return resp, err
+}
+
+func (c *Client) getContentType(reqOption *requestOptions) (contentType string) {
+	if reqOption != nil && reqOption.contentType != "" {
+		return reqOption.contentType
+	}
+
 	contentType = c.Options.ContentType
 	if contentType == "" {
 		contentType = DefaultContentType
@@ -179,7 +389,8 @@ func (c *Client) getContentType() (contentType string) {
 	return contentType
 }
 
-func copyBody(b interface{}) ([]byte, error) {
+// copyBody reads b, encoding values other than raw bodies with the codec of contentType
+func copyBody(b interface{}, contentType string) ([]byte, error) {
 	switch v := b.(type) {
 	case string:
 		return []byte(v), nil
@@ -199,10 +410,12 @@ func copyBody(b interface{}) ([]byte, error) {
 		return nil, nil
 
 	default:
-		j, err := json.Marshal(b)
+		// bodies of content types without a codec, e.g. vendor media types,
+		// are still encoded as JSON, as before codecs were introduced
+		codec, err := codecFor(contentType)
 		if err != nil {
-			return nil, err
+			codec = jsonCodec{}
 		}
-		return j, nil
+		return codec.Marshal(b)
 	}
 }
@@ -0,0 +1,121 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	clientAssertionType     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionLifetime = 60 * time.Second
+)
+
+type (
+	jwtHeader struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+		KeyID     string `json:"kid,omitempty"`
+	}
+
+	jwtClaims struct {
+		Issuer    string `json:"iss"`
+		Subject   string `json:"sub"`
+		Audience  string `json:"aud"`
+		ID        string `json:"jti"`
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+	}
+)
+
+// newClientAssertion signs a RFC 7523 client assertion JWT with RS256 or ES256,
+// depending on the key type
+func newClientAssertion(clientId string, audience string, key crypto.Signer, keyID string) (string, error) {
+	if key == nil {
+		return "", &ConfigError{Message: "PrivateKey is required by private_key_jwt authentication"}
+	}
+
+	var alg string
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		if pub.Curve.Params().BitSize != 256 {
+			return "", &ConfigError{Message: fmt.Sprintf("Unsupported ECDSA curve for private_key_jwt: %s", pub.Curve.Params().Name)}
+		}
+		alg = "ES256"
+	default:
+		return "", &ConfigError{Message: fmt.Sprintf("Unsupported key type for private_key_jwt: %T", pub)}
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(jwtHeader{Algorithm: alg, Type: "JWT", KeyID: keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{
+		Issuer:    clientId,
+		Subject:   clientId,
+		Audience:  audience,
+		ID:        hex.EncodeToString(jti),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(clientAssertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	if alg == "ES256" {
+		if signature, err = ecdsaJoseSignature(signature); err != nil {
+			return "", err
+		}
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ecdsaJoseSignature converts an ASN.1 ECDSA signature into the fixed size
+// R || S form required by JWS (RFC 7518 3.4)
+func ecdsaJoseSignature(der []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+
+	r, s := sig.R.Bytes(), sig.S.Bytes()
+	out := make([]byte, 64)
+	copy(out[32-len(r):32], r)
+	copy(out[64-len(s):], s)
+	return out, nil
+}
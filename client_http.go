@@ -0,0 +1,126 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+)
+
+// DoRequest sends a standard library request with the same token injection,
+// 401 retries and circuit breaker as the other methods. The request body is
+// buffered so it can be replayed, and the request context bounds the whole call.
+func (c *Client) DoRequest(req *http.Request, reqOptions ...*requestOptions) (*http.Response, error) {
+	var reqOption *requestOptions
+	if len(reqOptions) > 0 {
+		reqOption = reqOptions[0]
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withTotalTimeout(req.Context())
+	resp, err := c.execute(ctx, req.Method, reqOption, func(ctx context.Context, token *Token) (*http.Response, error) {
+		if err := verifyCertificateBinding(c.Options.TLSConfig, token); err != nil {
+			return nil, err
+		}
+		return c.requestHTTP(newAttemptRequest(ctx, req, body), token.Authorization, reqOption)
+	})
+	return cancelOnClose(resp, err, cancel)
+}
+
+func (c *Client) requestHTTP(req *http.Request, authorization string, reqOption *requestOptions) (*http.Response, error) {
+	req.Header.Set("Authorization", authorization)
+	if req.ContentLength > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", c.getContentType(reqOption))
+	}
+
+	if reqOption != nil {
+		for _, header := range reqOption.headers {
+			req.Header.Add(header.name, header.value)
+		}
+	}
+
+	if c.Options.ShowDebug {
+		dumpRequest(req)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func dumpRequest(req *http.Request) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		log.Println(string(dump))
+	}
+}
+
+// errNoResponse reports a RoundTripper breaking its contract by returning
+// neither a response nor an error
+var errNoResponse = errors.New("No response and no error returned")
+
+// cancelOnClose defers cancel until the response body is closed, since
+// reading a net/http body fails once its request context is canceled
+func cancelOnClose(resp *http.Response, err error, cancel context.CancelFunc) (*http.Response, error) {
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp == nil {
+		cancel()
+		return nil, errNoResponse
+	}
+
+	resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelReadCloser) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// readRequestBody buffers and closes the request body so it can be replayed
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	defer req.Body.Close() // nolint:errcheck
+	return ioutil.ReadAll(req.Body)
+}
+
+// newAttemptRequest copies req for a single attempt, with a fresh reader over
+// the buffered body
+func newAttemptRequest(ctx context.Context, req *http.Request, body []byte) *http.Request {
+	attempt := req.Clone(ctx)
+	if body == nil {
+		return attempt
+	}
+
+	attempt.ContentLength = int64(len(body))
+	attempt.Body = ioutil.NopCloser(bytes.NewReader(body))
+	attempt.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return attempt
+}
@@ -0,0 +1,209 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"gopkg.in/check.v1"
+)
+
+type clientHTTPSuite struct {
+	server *httptest.Server
+}
+
+var _ = check.Suite(&clientHTTPSuite{})
+
+func (s *clientHTTPSuite) SetUpSuite(c *check.C) {
+	s.server = newTestServerToken()
+}
+
+func (s *clientHTTPSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+}
+
+func (s *clientHTTPSuite) TestDoRequest(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "Bearer nonenoenoe")
+		c.Assert(r.Header.Get("X-Request-Id"), check.Equals, "123")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"method": "GET"}`)
+	})
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/get/feed/1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("X-Request-Id", "123")
+
+	client := NewClient()
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), check.Equals, `{"method": "GET"}`)
+}
+
+func (s *clientHTTPSuite) TestDoRequestReplaysBodyOnUnauthorized(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Assert(string(body), check.Equals, `{"body": "test"}`)
+		c.Assert(r.Header.Get("Content-Type"), check.Equals, DefaultContentType)
+
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/post/feed/1", strings.NewReader(`{"body": "test"}`))
+	c.Assert(err, check.IsNil)
+
+	client := NewClient()
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusCreated)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
+func (s *clientHTTPSuite) TestDoRequestMutualTLS(c *check.C) {
+	cert, err := newTestClientCertificate()
+	c.Assert(err, check.IsNil)
+
+	ts := newTestServerTLS(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.TLS.PeerCertificates, check.HasLen, 1)
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	bound := &Token{
+		Authorization: "Bearer bound",
+		Confirmation:  &Confirmation{X5tS256: certificateThumbprint(cert)},
+	}
+	tm := &staticTokenManager{token: bound}
+
+	options := defaultClientOptions
+	options.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+	client := NewClientCustom(tm, options)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/mtls/feed/1", nil)
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	bound.Confirmation.X5tS256 = "another-certificate"
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/mtls/feed/1", nil)
+	resp, err = client.DoRequest(req)
+	c.Assert(err, check.ErrorMatches, "Token is bound to certificate .*")
+	c.Assert(resp, check.IsNil)
+
+	bound.Confirmation.X5tS256 = certificateThumbprint(cert)
+	c.Assert(client.GetJSON(ts.URL+"/mtls/feed/1", nil), check.IsNil)
+
+	// the goreq based methods cannot present the certificate
+	goreqResp, err := client.Get(ts.URL + "/mtls/feed/1")
+	c.Assert(err, check.ErrorMatches, "TLSConfig is only supported by DoRequest, GetJSON and PostJSON")
+	c.Assert(goreqResp, check.IsNil)
+}
+
+func (s *clientHTTPSuite) TestDoRequestZeroOptions(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, ClientOptions{})
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/feed/1", nil)
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	_, err = cancelOnClose(nil, nil, func() {})
+	c.Assert(err, check.Equals, errNoResponse)
+}
+
+// slowTransport answers after delay whatever the request context, and
+// records whether the response body was closed
+type slowTransport struct {
+	delay  time.Duration
+	closed int32
+}
+
+func (t *slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	time.Sleep(t.delay)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       &closeRecorder{ReadCloser: ioutil.NopCloser(strings.NewReader("")), closed: &t.closed},
+		Request:    req,
+	}, nil
+}
+
+type closeRecorder struct {
+	io.ReadCloser
+	closed *int32
+}
+
+func (r *closeRecorder) Close() error {
+	atomic.StoreInt32(r.closed, 1)
+	return r.ReadCloser.Close()
+}
+
+func (s *clientHTTPSuite) TestDoRequestClosesLateHystrixResponse(c *check.C) {
+	transport := &slowTransport{delay: 100 * time.Millisecond}
+
+	HystrixConfigureCommand("clientHTTPLate", hystrix.CommandConfig{Timeout: 1000})
+	options := defaultClientOptions
+	options.HystrixConfig = NewHystrixConfig("clientHTTPLate")
+	options.HTTPClient = &http.Client{Transport: transport}
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/feed/1", nil)
+	_, err := client.DoRequest(req.WithContext(ctx))
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&transport.closed), check.Equals, int32(1))
+}
+
+type staticTokenManager struct {
+	token *Token
+}
+
+func (tm *staticTokenManager) GetToken() (*Token, error) {
+	return tm.token, nil
+}
+
+func (tm *staticTokenManager) ResetToken() {}
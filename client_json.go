@@ -0,0 +1,113 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/globocom/goreq"
+)
+
+// GetJSON sends a GET request and decodes its JSON response into out.
+// Responses other than 2xx are returned as a *StatusError, and the response
+// body is always closed.
+func (c *Client) GetJSON(url string, out interface{}, reqOptions ...*requestOptions) error {
+	return c.doJSON(context.Background(), http.MethodGet, url, nil, out, reqOptions...)
+}
+
+// PostJSON sends in encoded as JSON and decodes the JSON response into out,
+// as GetJSON does
+func (c *Client) PostJSON(url string, in interface{}, out interface{}, reqOptions ...*requestOptions) error {
+	return c.doJSON(context.Background(), http.MethodPost, url, in, out, reqOptions...)
+}
+
+func (c *Client) GetJSONContext(ctx context.Context, url string, out interface{}, reqOptions ...*requestOptions) error {
+	return c.doJSON(ctx, http.MethodGet, url, nil, out, reqOptions...)
+}
+
+func (c *Client) PostJSONContext(ctx context.Context, url string, in interface{}, out interface{}, reqOptions ...*requestOptions) error {
+	return c.doJSON(ctx, http.MethodPost, url, in, out, reqOptions...)
+}
+
+// DecodeResponse decodes a 2xx response into out with the codec of its
+// Content-Type, or of the request content type when the response has none,
+// and closes its body. Other responses are returned as a *StatusError.
+func (c *Client) DecodeResponse(resp *goreq.Response, out interface{}, reqOptions ...*requestOptions) error {
+	var reqOption *requestOptions
+	if len(reqOptions) > 0 {
+		reqOption = reqOptions[0]
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = c.getContentType(reqOption)
+	}
+
+	codec, err := codecFor(contentType)
+	if err != nil {
+		resp.Body.Close() // nolint:errcheck
+		return err
+	}
+	return c.decodeResponse(resp.StatusCode, resp.Header, resp.Body, out, codec)
+}
+
+func (c *Client) doJSON(ctx context.Context, method string, url string, in interface{}, out interface{}, reqOptions ...*requestOptions) error {
+	var reqOption *requestOptions
+	if len(reqOptions) > 0 {
+		reqOption = reqOptions[0]
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := jsonCodec{}.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	// sent through net/http, unlike the goreq based methods, so TLSConfig applies
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.DoRequest(req.WithContext(ctx), reqOption.withContentType(ContentTypeJSON))
+	if err != nil {
+		return err
+	}
+	return c.decodeResponse(resp.StatusCode, resp.Header, resp.Body, out, jsonCodec{})
+}
+
+// decodeResponse decodes a 2xx response into out, if any, and closes its body
+func (c *Client) decodeResponse(statusCode int, header http.Header, respBody io.ReadCloser, out interface{}, codec Codec) error {
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return newStatusError(statusCode, header, respBody, c.Options.maxErrorBodySize())
+	}
+	defer respBody.Close() // nolint:errcheck
+
+	maxSize := c.Options.maxResponseBodySize()
+	body, err := ioutil.ReadAll(io.LimitReader(respBody, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > maxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, maxSize)
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return codec.Unmarshal(body, out)
+}
@@ -0,0 +1,140 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+type clientJSONSuite struct{}
+
+var _ = check.Suite(&clientJSONSuite{})
+
+type feed struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func newJSONClient() *Client {
+	return NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, defaultClientOptions)
+}
+
+func (s *clientJSONSuite) TestGetJSON(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, http.MethodGet)
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "Bearer static")
+		c.Assert(r.TransferEncoding, check.HasLen, 0)
+		c.Assert(r.ContentLength, check.Equals, int64(0))
+		fmt.Fprint(w, `{"id": 1, "title": "galf"}`)
+	})
+	defer ts.Close()
+
+	var out feed
+	err := newJSONClient().GetJSON(ts.URL+"/feed/1", &out)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.DeepEquals, feed{ID: 1, Title: "galf"})
+}
+
+func (s *clientJSONSuite) TestJSONZeroOptions(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "title": "galf"}`)
+	})
+	defer ts.Close()
+
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, ClientOptions{})
+
+	var out feed
+	c.Assert(client.GetJSON(ts.URL+"/feed/1", &out), check.IsNil)
+	c.Assert(out, check.DeepEquals, feed{ID: 1, Title: "galf"})
+
+	out = feed{}
+	c.Assert(client.PostJSON(ts.URL+"/feed", feed{Title: "galf"}, &out), check.IsNil)
+	c.Assert(out.ID, check.Equals, 1)
+}
+
+func (s *clientJSONSuite) TestPostJSON(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, http.MethodPost)
+		c.Assert(r.Header.Get("Content-Type"), check.Equals, DefaultContentType)
+
+		var in feed
+		c.Assert(json.NewDecoder(r.Body).Decode(&in), check.IsNil)
+		in.ID = 2
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(in) // nolint:errcheck
+	})
+	defer ts.Close()
+
+	var out feed
+	err := newJSONClient().PostJSON(ts.URL+"/feed", feed{Title: "galf"}, &out)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.DeepEquals, feed{ID: 2, Title: "galf"})
+}
+
+func (s *clientJSONSuite) TestJSONNoContent(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	out := feed{ID: 1}
+	c.Assert(newJSONClient().PostJSON(ts.URL+"/feed", feed{Title: "galf"}, &out), check.IsNil)
+	c.Assert(out, check.DeepEquals, feed{ID: 1})
+	c.Assert(newJSONClient().PostJSON(ts.URL+"/feed", nil, nil), check.IsNil)
+}
+
+func (s *clientJSONSuite) TestJSONStatusError(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "not found"}`)
+	})
+	defer ts.Close()
+
+	var out feed
+	err := newJSONClient().GetJSON(ts.URL+"/feed/1", &out)
+
+	var statusErr *StatusError
+	c.Assert(errors.As(err, &statusErr), check.Equals, true)
+	c.Assert(statusErr.StatusCode, check.Equals, http.StatusNotFound)
+	c.Assert(string(statusErr.Body), check.Equals, `{"message": "not found"}`)
+}
+
+func (s *clientJSONSuite) TestJSONMaxResponseBodySize(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"title": "%s"}`, strings.Repeat("x", 100))
+	})
+	defer ts.Close()
+
+	client := newJSONClient()
+	client.Options.MaxResponseBodySize = 50
+
+	var out feed
+	err := client.GetJSON(ts.URL+"/feed/1", &out)
+	c.Assert(errors.Is(err, ErrResponseTooLarge), check.Equals, true)
+	c.Assert(err, check.ErrorMatches, "Response body too large: more than 50 bytes")
+}
+
+func (s *clientJSONSuite) TestJSONInvalidResponse(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<feed/>`)
+	})
+	defer ts.Close()
+
+	var out feed
+	var syntaxErr *json.SyntaxError
+	err := newJSONClient().GetJSON(ts.URL+"/feed/1", &out)
+	c.Assert(errors.As(err, &syntaxErr), check.Equals, true)
+}
@@ -8,15 +8,31 @@
 
 package galf
 
-import "time"
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
 
 const (
-	DefaultClientTimeout    = 20 * time.Second
-	DefaultClientMaxRetries = 2
-	DefaultContentType      = "application/json"
+	DefaultClientTimeout             = 20 * time.Second
+	DefaultClientMaxRetries          = 2
+	DefaultContentType               = "application/json"
+	DefaultClientMaxIdleConnsPerHost = 250
+	DefaultClientIdleConnTimeout     = 90 * time.Second
+	DefaultClientKeepAlive           = 30 * time.Second
+	DefaultClientMaxErrorBodySize    = 1024
+	DefaultClientMaxResponseBodySize = 10 << 20
 )
 
 type (
+	// StatusRange is an inclusive range of HTTP status codes
+	StatusRange struct {
+		From int
+		To   int
+	}
+
 	ClientOptions struct {
 		ContentType   string
 		Timeout       time.Duration
@@ -24,10 +40,43 @@ type (
 		MaxRetries    int
 		ShowDebug     bool
 		HystrixConfig *HystrixConfig
+		// TotalTimeout, when set, bounds the whole call, retries and backoffs
+		// included, while Timeout bounds each attempt
+		TotalTimeout time.Duration
+		// RetryPolicy, when set, also retries transient failures; otherwise
+		// only 401 responses are retried, after renewing the token
+		RetryPolicy *RetryPolicy
+		// MaxRetryAfter caps the wait requested by a Retry-After header on a
+		// retried response, DefaultMaxRetryAfter when zero
+		MaxRetryAfter time.Duration
+		// RetryBudget, when set, stops retrying once its budget is exhausted
+		RetryBudget *RetryBudget
+		// ErrorStatuses, when set, turns the final responses with these
+		// statuses into a *StatusError, e.g. NonSuccessStatuses
+		ErrorStatuses []StatusRange
+		// MaxErrorBodySize bounds the body kept by a StatusError,
+		// DefaultClientMaxErrorBodySize when zero
+		MaxErrorBodySize int
+		// MaxResponseBodySize bounds the bodies decoded by GetJSON, PostJSON
+		// and DecodeResponse, DefaultClientMaxResponseBodySize when zero
+		MaxResponseBodySize int64
+
+		// TLSConfig configures the connections of DoRequest, GetJSON and
+		// PostJSON, e.g. the client certificate certificate-bound tokens must
+		// be presented with. goreq has no TLS settings, so the goreq based
+		// methods fail with a ConfigError when it is set.
+		TLSConfig *tls.Config
+		// HTTPClient, when set, is used as is by DoRequest
+		HTTPClient *http.Client
+		// Transport, when set, replaces the transport built from TLSConfig
+		Transport http.RoundTripper
 	}
 )
 
 var (
+	// NonSuccessStatuses covers every status but 2xx, for ClientOptions.ErrorStatuses
+	NonSuccessStatuses = []StatusRange{{From: 100, To: 199}, {From: 300, To: 599}}
+
 	defaultClientOptions = ClientOptions{
 		ContentType:   DefaultContentType,
 		Timeout:       DefaultClientTimeout,
@@ -57,3 +106,69 @@ func NewClientOptions(timeout time.Duration, debug bool, maxRetries int, hystrix
 		HystrixConfig: hystrixConfig,
 	}
 }
+
+func (co ClientOptions) isErrorStatus(statusCode int) bool {
+	for _, r := range co.ErrorStatuses {
+		if statusCode >= r.From && statusCode <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAttempts is MaxRetries, counting the first attempt, which is always made
+func (co ClientOptions) maxAttempts() int {
+	if co.MaxRetries < 1 {
+		return 1
+	}
+	return co.MaxRetries
+}
+
+func (co ClientOptions) backoff(retry int) time.Duration {
+	if co.Backoff == nil {
+		return ConstantBackOff(retry)
+	}
+	return co.Backoff(retry)
+}
+
+func (co ClientOptions) maxErrorBodySize() int {
+	if co.MaxErrorBodySize <= 0 {
+		return DefaultClientMaxErrorBodySize
+	}
+	return co.MaxErrorBodySize
+}
+
+func (co ClientOptions) maxResponseBodySize() int64 {
+	if co.MaxResponseBodySize <= 0 {
+		return DefaultClientMaxResponseBodySize
+	}
+	return co.MaxResponseBodySize
+}
+
+// newHTTPClient builds the client used by the net/http based API
+func (co ClientOptions) newHTTPClient() *http.Client {
+	if co.HTTPClient != nil {
+		return co.HTTPClient
+	}
+
+	transport := co.Transport
+	if transport == nil {
+		dialer := &net.Dialer{
+			Timeout:   co.Timeout,
+			KeepAlive: DefaultClientKeepAlive,
+		}
+		transport = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     co.TLSConfig,
+			TLSHandshakeTimeout: co.Timeout,
+			MaxIdleConnsPerHost: DefaultClientMaxIdleConnsPerHost,
+			IdleConnTimeout:     DefaultClientIdleConnTimeout,
+		}
+	}
+
+	return &http.Client{
+		Timeout:   co.Timeout,
+		Transport: transport,
+	}
+}
@@ -9,7 +9,9 @@
 package galf
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -163,6 +165,78 @@ func (cs *clientSuite) TestDeleteClient(c *check.C) {
 	c.Assert(body, check.Equals, "")
 }
 
+func (cs *clientSuite) TestDoClient(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "Bearer nonenoenoe")
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprint(w, string(body))
+		}
+	})
+	defer ts.Close()
+
+	client := NewClient()
+	url := fmt.Sprintf("%s/do/feed/1", ts.URL)
+
+	resp, err := client.Do("PROPFIND", url, `{"depth": 1}`)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, "PROPFIND")
+	body, _ := resp.Body.ToString()
+	c.Assert(body, check.Equals, `{"depth": 1}`)
+
+	resp, err = client.Patch(url, `{"op": "replace"}`)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodPatch)
+	body, _ = resp.Body.ToString()
+	c.Assert(body, check.Equals, `{"op": "replace"}`)
+
+	resp, err = client.Head(url)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodHead)
+
+	resp, err = client.OptionsRequest(url)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodOptions)
+
+	ctx := context.Background()
+	resp, err = client.PatchContext(ctx, url, `{"op": "add"}`)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodPatch)
+	body, _ = resp.Body.ToString()
+	c.Assert(body, check.Equals, `{"op": "add"}`)
+
+	resp, err = client.HeadContext(ctx, url)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodHead)
+
+	resp, err = client.OptionsRequestContext(ctx, url)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("X-Method"), check.Equals, http.MethodOptions)
+}
+
+func (cs *clientSuite) TestClientZeroOptions(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	tm := &staticTokenManager{token: &Token{Authorization: "Bearer static"}}
+	resp, err := NewClientCustom(tm, ClientOptions{}).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+
+	// without Backoff, retries wait as with ConstantBackOff
+	resp, err = NewClientCustom(tm, ClientOptions{MaxRetries: 2}).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+}
+
 func (cs *clientSuite) TestStatusUnauthorizedClient(c *check.C) {
 	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -433,7 +507,7 @@ func (cs *clientSuite) TestConcurrencyRequest(c *check.C) {
 		go func() {
 			defer wg.Done()
 
-			resp, err := client.request(token.Authorization, http.MethodGet, url, nil, nil)
+			resp, err := client.request(context.Background(), token.Authorization, http.MethodGet, url, nil, nil)
 
 			c.Assert(err, check.IsNil)
 			c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
@@ -446,6 +520,47 @@ func (cs *clientSuite) TestConcurrencyRequest(c *check.C) {
 
 }
 
+func (cs *clientSuite) TestGetContextCanceled(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	client := NewClient()
+	start := time.Now()
+	resp, err := client.GetContext(ctx, ts.URL+"/context/feed/1")
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(resp, check.IsNil)
+	c.Assert(time.Since(start) < 400*time.Millisecond, check.Equals, true)
+}
+
+func (cs *clientSuite) TestPostContextCanceledDuringBackoff(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	options := defaultClientOptions
+	options.Backoff = ExponentialBackoff
+	client := NewClient(options)
+
+	start := time.Now()
+	resp, err := client.PostContext(ctx, ts.URL+"/context/feed/1", `{"body": "test"}`)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(resp, check.IsNil)
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
 func responseHeaders(rw http.ResponseWriter, r *http.Request) {
 	for name, headers := range r.Header {
 		for _, v := range headers {
@@ -0,0 +1,207 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeXML      = "application/xml"
+	ContentTypeForm     = "application/x-www-form-urlencoded"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/msgpack"
+)
+
+// Codec encodes request bodies and decodes response bodies of a content type.
+// JSON, XML, form, protobuf and msgpack codecs are registered by default, and
+// others are plugged in with RegisterCodec. Request bodies of other content
+// types are encoded as JSON.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs map[string]Codec
+var codecsMutex *sync.RWMutex
+
+func init() {
+	codecs = map[string]Codec{
+		ContentTypeJSON:         jsonCodec{},
+		ContentTypeXML:          xmlCodec{},
+		"text/xml":              xmlCodec{},
+		ContentTypeForm:         formCodec{},
+		ContentTypeProtobuf:     protobufCodec{},
+		"application/protobuf":  protobufCodec{},
+		ContentTypeMsgpack:      msgpackCodec{},
+		"application/x-msgpack": msgpackCodec{},
+	}
+	codecsMutex = &sync.RWMutex{}
+}
+
+// RegisterCodec sets the codec of a content type, replacing any previous one
+func RegisterCodec(contentType string, codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecs[mediaType(contentType)] = codec
+}
+
+// codecFor returns the codec of a content type; media types with a +json or
+// +xml suffix, e.g. application/problem+json, fall back to the JSON and XML codecs
+func codecFor(contentType string) (Codec, error) {
+	name := mediaType(contentType)
+
+	codecsMutex.RLock()
+	codec, exists := codecs[name]
+	if !exists {
+		switch {
+		case strings.HasSuffix(name, "+json"):
+			codec, exists = codecs[ContentTypeJSON]
+		case strings.HasSuffix(name, "+xml"):
+			codec, exists = codecs[ContentTypeXML]
+		}
+	}
+	codecsMutex.RUnlock()
+
+	if !exists {
+		return nil, &ConfigError{Message: fmt.Sprintf("No codec registered for content type: %s", contentType)}
+	}
+	return codec, nil
+}
+
+// mediaType strips the parameters of a content type, e.g. charset
+func mediaType(contentType string) string {
+	if name, _, err := mime.ParseMediaType(contentType); err == nil {
+		return name
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// formCodec encodes url.Values, map[string]string and map[string][]string,
+// and decodes into pointers to them
+type formCodec struct{}
+
+func (formCodec) Marshal(v interface{}) ([]byte, error) {
+	switch form := v.(type) {
+	case url.Values:
+		return []byte(form.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(form).Encode()), nil
+	case map[string]string:
+		values := url.Values{}
+		for name, value := range form {
+			values.Set(name, value)
+		}
+		return []byte(values.Encode()), nil
+	}
+	return nil, fmt.Errorf("Form codec cannot encode %T", v)
+}
+
+func (formCodec) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch form := v.(type) {
+	case *url.Values:
+		*form = values
+	case *map[string][]string:
+		*form = values
+	case *map[string]string:
+		*form = make(map[string]string, len(values))
+		for name := range values {
+			(*form)[name] = values.Get(name)
+		}
+	default:
+		return fmt.Errorf("Form codec cannot decode into %T", v)
+	}
+	return nil
+}
+
+// protobufMessage is implemented by the messages generated by gogo/protobuf,
+// so protobuf bodies need no dependency here
+type protobufMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// protobufCodec encodes and decodes messages implementing Marshal and Unmarshal
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	if message, ok := v.(protobufMessage); ok {
+		return message.Marshal()
+	}
+	return nil, fmt.Errorf("Protobuf codec cannot encode %T", v)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if message, ok := v.(protobufMessage); ok {
+		return message.Unmarshal(data)
+	}
+	return fmt.Errorf("Protobuf codec cannot decode into %T", v)
+}
+
+// msgpackMarshaler and msgpackUnmarshaler are implemented by the types
+// generated by tinylib/msgp, so msgpack bodies need no dependency here
+type msgpackMarshaler interface {
+	MarshalMsg(b []byte) ([]byte, error)
+}
+
+type msgpackUnmarshaler interface {
+	UnmarshalMsg(b []byte) ([]byte, error)
+}
+
+// msgpackCodec encodes and decodes values implementing MarshalMsg and UnmarshalMsg
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	if marshaler, ok := v.(msgpackMarshaler); ok {
+		return marshaler.MarshalMsg(nil)
+	}
+	return nil, fmt.Errorf("Msgpack codec cannot encode %T", v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	unmarshaler, ok := v.(msgpackUnmarshaler)
+	if !ok {
+		return fmt.Errorf("Msgpack codec cannot decode into %T", v)
+	}
+	_, err := unmarshaler.UnmarshalMsg(data)
+	return err
+}
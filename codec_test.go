@@ -0,0 +1,243 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+type codecSuite struct{}
+
+var _ = check.Suite(&codecSuite{})
+
+type xmlFeed struct {
+	XMLName xml.Name `xml:"feed"`
+	ID      int      `xml:"id"`
+	Title   string   `xml:"title"`
+}
+
+// upperCodec stands in for a third-party codec such as msgpack
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(fmt.Sprint(v))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*string)) = strings.ToLower(string(data))
+	return nil
+}
+
+// rawMessage stands in for the types generated by gogo/protobuf and
+// tinylib/msgp, prefixing its payload with the format
+type rawMessage struct {
+	payload string
+}
+
+func (m *rawMessage) Marshal() ([]byte, error) {
+	return []byte("pb:" + m.payload), nil
+}
+
+func (m *rawMessage) Unmarshal(data []byte) error {
+	m.payload = strings.TrimPrefix(string(data), "pb:")
+	return nil
+}
+
+func (m *rawMessage) MarshalMsg(b []byte) ([]byte, error) {
+	return append(b, "mp:"+m.payload...), nil
+}
+
+func (m *rawMessage) UnmarshalMsg(b []byte) ([]byte, error) {
+	m.payload = strings.TrimPrefix(string(b), "mp:")
+	return nil, nil
+}
+
+func echoContent(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Write(body) // nolint:errcheck
+}
+
+func (s *codecSuite) TestCodecFor(c *check.C) {
+	for contentType, expected := range map[string]Codec{
+		"application/json":                jsonCodec{},
+		"application/json; charset=utf-8": jsonCodec{},
+		"application/problem+json":        jsonCodec{},
+		"Application/XML":                 xmlCodec{},
+		"text/xml; charset=utf-8":         xmlCodec{},
+		"application/atom+xml":            xmlCodec{},
+		ContentTypeForm:                   formCodec{},
+		ContentTypeProtobuf:               protobufCodec{},
+		"application/protobuf":            protobufCodec{},
+		ContentTypeMsgpack:                msgpackCodec{},
+		"application/x-msgpack":           msgpackCodec{},
+	} {
+		codec, err := codecFor(contentType)
+		c.Assert(err, check.IsNil)
+		c.Assert(codec, check.Equals, expected, check.Commentf(contentType))
+	}
+
+	_, err := codecFor("application/x-thrift")
+	var configErr *ConfigError
+	c.Assert(errors.As(err, &configErr), check.Equals, true)
+	c.Assert(err, check.ErrorMatches, "No codec registered for content type: application/x-thrift")
+}
+
+func (s *codecSuite) TestFormCodec(c *check.C) {
+	data, err := formCodec{}.Marshal(map[string]string{"b": "2", "a": "1 2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "a=1+2&b=2")
+
+	data, err = formCodec{}.Marshal(url.Values{"a": {"1", "2"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "a=1&a=2")
+
+	_, err = formCodec{}.Marshal(struct{}{})
+	c.Assert(err, check.ErrorMatches, "Form codec cannot encode struct {}")
+
+	var values url.Values
+	c.Assert(formCodec{}.Unmarshal([]byte("a=1&a=2"), &values), check.IsNil)
+	c.Assert(values, check.DeepEquals, url.Values{"a": {"1", "2"}})
+
+	var form map[string]string
+	c.Assert(formCodec{}.Unmarshal([]byte("a=1&b=2"), &form), check.IsNil)
+	c.Assert(form, check.DeepEquals, map[string]string{"a": "1", "b": "2"})
+}
+
+func (s *codecSuite) TestClientFormContentType(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), check.Equals, ContentTypeForm)
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.PostForm.Get("title"), check.Equals, "galf")
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	options := defaultClientOptions
+	options.ContentType = ContentTypeForm
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, options)
+
+	resp, err := client.Post(ts.URL+"/feed", map[string]string{"title": "galf"})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusCreated)
+}
+
+func (s *codecSuite) TestClientPerRequestContentType(c *check.C) {
+	ts := newTestServerCustom(echoContent)
+	defer ts.Close()
+
+	client := newJSONClient()
+	reqOptions := NewRequestOptions()
+	reqOptions.SetContentType(ContentTypeXML)
+
+	resp, err := client.Post(ts.URL+"/feed", xmlFeed{ID: 1, Title: "galf"}, reqOptions)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("Content-Type"), check.Equals, ContentTypeXML)
+
+	var out xmlFeed
+	c.Assert(client.DecodeResponse(resp, &out), check.IsNil)
+	c.Assert(out.ID, check.Equals, 1)
+	c.Assert(out.Title, check.Equals, "galf")
+}
+
+func (s *codecSuite) TestRegisterCodec(c *check.C) {
+	ts := newTestServerCustom(echoContent)
+	defer ts.Close()
+
+	RegisterCodec("application/x-upper; charset=utf-8", upperCodec{})
+
+	reqOptions := NewRequestOptions()
+	reqOptions.SetContentType("application/x-upper")
+	client := newJSONClient()
+
+	resp, err := client.Put(ts.URL+"/feed", 42.5, reqOptions)
+	c.Assert(err, check.IsNil)
+
+	var out string
+	c.Assert(client.DecodeResponse(resp, &out, reqOptions), check.IsNil)
+	c.Assert(out, check.Equals, "42.5")
+}
+
+func (s *codecSuite) TestProtobufAndMsgpackCodecs(c *check.C) {
+	ts := newTestServerCustom(echoContent)
+	defer ts.Close()
+
+	client := newJSONClient()
+	for contentType, encoded := range map[string]string{
+		ContentTypeProtobuf: "pb:galf",
+		ContentTypeMsgpack:  "mp:galf",
+	} {
+		reqOptions := NewRequestOptions()
+		reqOptions.SetContentType(contentType)
+
+		resp, err := client.Post(ts.URL+"/feed", &rawMessage{payload: "galf"}, reqOptions)
+		c.Assert(err, check.IsNil)
+		body, _ := resp.Body.ToString()
+		c.Assert(body, check.Equals, encoded)
+
+		resp, err = client.Post(ts.URL+"/feed", &rawMessage{payload: "galf"}, reqOptions)
+		c.Assert(err, check.IsNil)
+		c.Assert(resp.Header.Get("Content-Type"), check.Equals, contentType)
+
+		var out rawMessage
+		c.Assert(client.DecodeResponse(resp, &out), check.IsNil)
+		c.Assert(out.payload, check.Equals, "galf")
+
+		_, err = client.Post(ts.URL+"/feed", map[string]int{"id": 1}, reqOptions)
+		c.Assert(err, check.ErrorMatches, ".* codec cannot encode map\\[string\\]int")
+	}
+}
+
+func (s *codecSuite) TestUnregisteredContentType(c *check.C) {
+	ts := newTestServerCustom(echoContent)
+	defer ts.Close()
+
+	reqOptions := NewRequestOptions()
+	reqOptions.SetContentType("application/vnd.globo.v1")
+	client := newJSONClient()
+
+	// request bodies fall back to JSON
+	resp, err := client.Post(ts.URL+"/feed", map[string]int{"id": 1}, reqOptions)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Header.Get("Content-Type"), check.Equals, "application/vnd.globo.v1")
+
+	var out map[string]int
+	err = client.DecodeResponse(resp, &out)
+	c.Assert(err, check.ErrorMatches, "No codec registered for content type: application/vnd.globo.v1")
+
+	resp, err = client.Post(ts.URL+"/feed", map[string]int{"id": 1}, reqOptions)
+	c.Assert(err, check.IsNil)
+	body, _ := resp.Body.ToString()
+	c.Assert(body, check.Equals, `{"id":1}`)
+}
+
+func (s *codecSuite) TestPostJSONIgnoresClientContentType(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), check.Equals, ContentTypeJSON)
+		w.Header().Set("Content-Type", ContentTypeXML)
+		fmt.Fprint(w, `{"id": 1, "title": "galf"}`)
+	})
+	defer ts.Close()
+
+	options := defaultClientOptions
+	options.ContentType = ContentTypeXML
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, options)
+
+	var out feed
+	c.Assert(client.PostJSON(ts.URL+"/feed", feed{Title: "galf"}, &out), check.IsNil)
+	c.Assert(out, check.DeepEquals, feed{ID: 1, Title: "galf"})
+}
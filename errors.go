@@ -8,10 +8,37 @@
 
 package galf
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
 
-var TokenExpiredError = errors.New("Token expired")
+	"github.com/afex/hystrix-go/hystrix"
+)
 
+var (
+	TokenExpiredError = errors.New("Token expired")
+
+	// ErrCircuitOpen matches, with errors.Is, the errors of calls rejected
+	// because their circuit is open
+	ErrCircuitOpen = errors.New("Circuit open")
+
+	// ErrResponseTooLarge matches, with errors.Is, the errors of responses
+	// larger than ClientOptions.MaxResponseBodySize
+	ErrResponseTooLarge = errors.New("Response body too large")
+
+	// ErrAuthorizationRequired matches, with errors.Is, the errors of refresh
+	// tokens the endpoint rejected for good; the authorization flow must be
+	// run again
+	ErrAuthorizationRequired = errors.New("Authorization required")
+)
+
+// HTTP is a failed status of the token endpoint. It is wrapped in a
+// TokenEndpointError, so match it with errors.As rather than a type assertion.
 type HTTP struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -24,3 +51,187 @@ func (e *HTTP) Error() string {
 func NewHttpError(code int, message string) *HTTP {
 	return &HTTP{Code: code, Message: message}
 }
+
+// ConfigError reports a Client or TokenManager that cannot work as
+// configured; retrying does not help
+type ConfigError struct {
+	Message string
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// TokenEndpointError reports a failed request to the token endpoint.
+// StatusCode is zero when no response was received.
+type TokenEndpointError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by the endpoint through Retry-After, if any
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *TokenEndpointError) Error() string {
+	if _, ok := e.Err.(*HTTP); ok {
+		return e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("Failed to request token url: %s - statusCode: %d - %v", e.URL, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("Failed to request token url: %s - %v", e.URL, e.Err)
+}
+
+func (e *TokenEndpointError) Unwrap() error {
+	return e.Err
+}
+
+// Error codes of the token endpoint (RFC 6749 5.2)
+const (
+	OAuthInvalidRequest         = "invalid_request"
+	OAuthInvalidClient          = "invalid_client"
+	OAuthInvalidGrant           = "invalid_grant"
+	OAuthUnauthorizedClient     = "unauthorized_client"
+	OAuthUnsupportedGrantType   = "unsupported_grant_type"
+	OAuthInvalidScope           = "invalid_scope"
+	OAuthServerError            = "server_error"
+	OAuthTemporarilyUnavailable = "temporarily_unavailable"
+)
+
+// OAuthError is an error response of the token endpoint (RFC 6749 5.2)
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+	StatusCode  int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("OAuth error: %s", e.Code)
+	}
+	return fmt.Sprintf("OAuth error: %s - %s", e.Code, e.Description)
+}
+
+// Permanent reports whether sending the same request again cannot succeed,
+// e.g. with invalid client credentials or a revoked grant. Only the RFC 6749
+// codes meaning so are permanent, and never with a 429, so unknown codes such
+// as rate limits are retried.
+func (e *OAuthError) Permanent() bool {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+
+	switch e.Code {
+	case OAuthInvalidRequest, OAuthInvalidClient, OAuthInvalidGrant,
+		OAuthUnauthorizedClient, OAuthUnsupportedGrantType, OAuthInvalidScope:
+		return true
+	}
+	return false
+}
+
+// parseOAuthError decodes an RFC 6749 error response, returning nil when
+// body is not one
+func parseOAuthError(statusCode int, body []byte) *OAuthError {
+	var oauthErr OAuthError
+	if err := json.Unmarshal(body, &oauthErr); err != nil || oauthErr.Code == "" {
+		return nil
+	}
+	oauthErr.StatusCode = statusCode
+	return &oauthErr
+}
+
+// CircuitError reports a call rejected or abandoned by the circuit breaker
+type CircuitError struct {
+	Name string
+	Err  error
+}
+
+func (e *CircuitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CircuitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CircuitError) Is(target error) bool {
+	return target == ErrCircuitOpen && e.Err == hystrix.ErrCircuitOpen
+}
+
+// RefreshTokenError reports a refresh token rejected for good, e.g. revoked
+// or expired; it matches ErrAuthorizationRequired
+type RefreshTokenError struct {
+	Err error
+}
+
+func (e *RefreshTokenError) Error() string {
+	return fmt.Sprintf("Refresh token rejected: %v", e.Err)
+}
+
+func (e *RefreshTokenError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RefreshTokenError) Is(target error) bool {
+	return target == ErrAuthorizationRequired
+}
+
+// StatusError reports a response whose status is one of the
+// ClientOptions.ErrorStatuses. The response body is closed; Body keeps its
+// first MaxErrorBodySize bytes.
+type StatusError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Challenge is the Bearer challenge of the response, if any, e.g. the
+	// scope missing from the token of a 403
+	Challenge *BearerChallenge
+	// RetryAfter is the delay requested through Retry-After, if any
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Unexpected status code: %d - body: %s", e.StatusCode, e.Body)
+}
+
+// newStatusError reads up to maxBodySize bytes of body and closes it
+func newStatusError(statusCode int, header http.Header, body io.ReadCloser, maxBodySize int) *StatusError {
+	defer body.Close() // nolint:errcheck
+
+	snippet, _ := ioutil.ReadAll(io.LimitReader(body, int64(maxBodySize)))
+	retryAfter, _ := parseRetryAfter(header, time.Now())
+	return &StatusError{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       snippet,
+		Challenge:  ParseBearerChallenge(header),
+		RetryAfter: retryAfter,
+	}
+}
+
+// RetriesExhaustedError reports a call that failed on every attempt.
+// StatusCode and RetryAfter come from the last response, zero if there was
+// none or it requested no delay.
+type RetriesExhaustedError struct {
+	Attempts   int
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("%v - attempts: %d", e.Err, e.Attempts)
+}
+
+func (e *RetriesExhaustedError) Unwrap() error {
+	return e.Err
+}
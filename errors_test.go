@@ -0,0 +1,242 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"gopkg.in/check.v1"
+)
+
+type errorsSuite struct{}
+
+var _ = check.Suite(&errorsSuite{})
+
+func (s *errorsSuite) TestConfigError(c *check.C) {
+	client := NewClientCustom(nil, defaultClientOptions)
+	_, err := client.Get("http://localhost/feed/1")
+
+	var configErr *ConfigError
+	c.Assert(errors.As(err, &configErr), check.Equals, true)
+	c.Assert(err, check.ErrorMatches, "Configure tokenManager or SetDefaultTokenManager")
+
+	options := defaultClientOptions
+	options.HystrixConfig = NewHystrixConfig("errorsNotConfigured")
+	client = NewClientCustom(&staticTokenManager{token: &Token{}}, options)
+	_, err = client.Get("http://localhost/feed/1")
+	c.Assert(errors.As(err, &configErr), check.Equals, true)
+}
+
+func (s *errorsSuite) TestCircuitError(c *check.C) {
+	err := (&HystrixConfig{configName: "errors"}).circuitError(hystrix.ErrCircuitOpen)
+
+	var circuitErr *CircuitError
+	c.Assert(errors.As(err, &circuitErr), check.Equals, true)
+	c.Assert(circuitErr.Name, check.Equals, "errors")
+	c.Assert(errors.Is(err, ErrCircuitOpen), check.Equals, true)
+	c.Assert(errors.Is(err, hystrix.ErrCircuitOpen), check.Equals, true)
+
+	err = (&HystrixConfig{configName: "errors"}).circuitError(hystrix.ErrTimeout)
+	c.Assert(errors.Is(err, ErrCircuitOpen), check.Equals, false)
+	c.Assert(errors.Is(err, hystrix.ErrTimeout), check.Equals, true)
+
+	cause := errors.New("request failed")
+	c.Assert((&HystrixConfig{}).circuitError(cause), check.Equals, cause)
+}
+
+func (s *errorsSuite) TestHystrixTimeoutCircuitError(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	HystrixConfigureCommand("errorsTimeout", hystrix.CommandConfig{Timeout: 10})
+	options := defaultClientOptions
+	options.HystrixConfig = NewHystrixConfig("errorsTimeout")
+	client := NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, options)
+
+	_, err := client.Get(ts.URL + "/feed/1")
+	var circuitErr *CircuitError
+	c.Assert(errors.As(err, &circuitErr), check.Equals, true)
+	c.Assert(circuitErr.Name, check.Equals, "errorsTimeout")
+	c.Assert(errors.Is(err, hystrix.ErrTimeout), check.Equals, true)
+}
+
+func (s *errorsSuite) TestClientRetriesExhausted(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {})
+	url := ts.URL
+	ts.Close()
+
+	_, err := newRetryPolicyClient(NewRetryPolicy()).Get(url + "/feed/1")
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.Attempts, check.Equals, 3)
+	c.Assert(exhausted.StatusCode, check.Equals, 0)
+	c.Assert(err, check.ErrorMatches, ".* - attempts: 3")
+}
+
+func (s *errorsSuite) TestClientErrorsCarryRetryAfter(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	client.Options.MaxRetryAfter = 10 * time.Millisecond
+	client.Options.ErrorStatuses = NonSuccessStatuses
+	_, err := client.Get(ts.URL + "/feed/1")
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(exhausted.RetryAfter, check.Equals, 2*time.Second)
+
+	var statusErr *StatusError
+	c.Assert(errors.As(err, &statusErr), check.Equals, true)
+	c.Assert(statusErr.RetryAfter, check.Equals, 2*time.Second)
+}
+
+func (s *errorsSuite) TestTokenEndpointErrors(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer ts.Close()
+
+	_, err := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret").GetToken()
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.Attempts, check.Equals, DefaultTokenMaxRetries)
+	c.Assert(exhausted.StatusCode, check.Equals, http.StatusBadGateway)
+
+	var endpointErr *TokenEndpointError
+	c.Assert(errors.As(err, &endpointErr), check.Equals, true)
+	c.Assert(endpointErr.URL, check.Equals, ts.URL+"/token")
+	c.Assert(endpointErr.StatusCode, check.Equals, http.StatusBadGateway)
+
+	var httpErr *HTTP
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.Code, check.Equals, http.StatusBadGateway)
+
+	ts.Close()
+	_, err = NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret").GetToken()
+	c.Assert(errors.As(err, &endpointErr), check.Equals, true)
+	c.Assert(endpointErr.StatusCode, check.Equals, 0)
+	c.Assert(err, check.ErrorMatches, "Failed to request token url: .*")
+}
+
+func (s *errorsSuite) TestTokenManagerConfigErrorNotRetried(c *check.C) {
+	options := defaultTokenOptions
+	options.AuthMethod = PrivateKeyJWT
+	tm := NewTokenManager("http://localhost/token", "ClientId", "ClientSecret", options)
+
+	_, err := tm.GetToken()
+	var configErr *ConfigError
+	c.Assert(errors.As(err, &configErr), check.Equals, true)
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, false)
+}
+
+func (s *errorsSuite) TestStatusError(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "123")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	client.Options.ErrorStatuses = NonSuccessStatuses
+	client.Options.MaxErrorBodySize = 10
+
+	resp, err := client.Get(ts.URL + "/feed/1")
+	c.Assert(resp, check.IsNil)
+	c.Assert(err, check.ErrorMatches, "Unexpected status code: 404 - body: xxxxxxxxxx")
+
+	var statusErr *StatusError
+	c.Assert(errors.As(err, &statusErr), check.Equals, true)
+	c.Assert(statusErr.StatusCode, check.Equals, http.StatusNotFound)
+	c.Assert(statusErr.Header.Get("X-Request-Id"), check.Equals, "123")
+	c.Assert(statusErr.Body, check.HasLen, 10)
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, false)
+}
+
+func (s *errorsSuite) TestStatusErrorRanges(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(nil)
+	client.Options.ErrorStatuses = []StatusRange{{From: 500, To: 599}}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/feed/1", nil)
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusNotFound)
+}
+
+func (s *errorsSuite) TestStatusErrorAfterRetries(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(nil)
+	client.Options.ErrorStatuses = NonSuccessStatuses
+
+	resp, err := client.Get(ts.URL + "/feed/1")
+	c.Assert(resp, check.IsNil)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.Attempts, check.Equals, 3)
+	c.Assert(exhausted.StatusCode, check.Equals, http.StatusUnauthorized)
+
+	var statusErr *StatusError
+	c.Assert(errors.As(err, &statusErr), check.Equals, true)
+	c.Assert(statusErr.StatusCode, check.Equals, http.StatusUnauthorized)
+}
+
+func (s *errorsSuite) TestStatusErrorIgnoredByTransport(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer ts.Close()
+
+	options := defaultClientOptions
+	options.ErrorStatuses = NonSuccessStatuses
+	httpClient := &http.Client{Transport: NewTransport(nil, &staticTokenManager{token: &Token{}}, options)}
+
+	resp, err := httpClient.Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusNotFound)
+}
+
+func (s *errorsSuite) TestOAuthError(c *check.C) {
+	err := &OAuthError{Code: "invalid_client", Description: "Client authentication failed"}
+	c.Assert(err, check.ErrorMatches, "OAuth error: invalid_client - Client authentication failed")
+	c.Assert(&OAuthError{Code: "invalid_grant"}, check.ErrorMatches, "OAuth error: invalid_grant")
+}
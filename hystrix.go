@@ -9,7 +9,6 @@
 package galf
 
 import (
-	"errors"
 	"fmt"
 	"sync"
 
@@ -42,13 +41,21 @@ func (hc *HystrixConfig) valid() error {
 	hystrixMutex.RUnlock()
 
 	if !exists {
-		msg := fmt.Sprintf("Hystrix config name not found: %s", hc.configName)
-		return errors.New(msg)
+		return &ConfigError{Message: fmt.Sprintf("Hystrix config name not found: %s", hc.configName)}
 	}
 
 	return nil
 }
 
+// circuitError wraps the errors raised by hystrix itself, leaving the errors
+// of the command untouched
+func (hc *HystrixConfig) circuitError(err error) error {
+	if _, ok := err.(hystrix.CircuitError); ok {
+		return &CircuitError{Name: hc.configName, Err: err}
+	}
+	return err
+}
+
 // ConfigureCommand applies settings for a circuit
 func HystrixConfigureCommand(configName string, config hystrix.CommandConfig) {
 	hystrixMutex.Lock()
@@ -9,7 +9,9 @@
 package galf
 
 type requestOptions struct {
-	headers []headerTuple
+	headers     []headerTuple
+	scopes      []string
+	contentType string
 }
 
 type headerTuple struct {
@@ -33,3 +35,25 @@ func (ro *requestOptions) AddHeaders(headers map[string]string) {
 		ro.AddHeader(name, value)
 	}
 }
+
+// SetContentType overrides ClientOptions.ContentType for the request, selecting
+// both its Content-Type header and the codec encoding its body
+func (ro *requestOptions) SetContentType(contentType string) {
+	ro.contentType = contentType
+}
+
+// withContentType returns a copy of ro, which may be nil, with its content type set
+func (ro *requestOptions) withContentType(contentType string) *requestOptions {
+	copied := requestOptions{}
+	if ro != nil {
+		copied = *ro
+	}
+	copied.contentType = contentType
+	return &copied
+}
+
+// SetScopes selects the scopes of the token sent with the request; the
+// client TokenManager must implement ScopedTokenManager
+func (ro *requestOptions) SetScopes(scopes ...string) {
+	ro.scopes = scopes
+}
@@ -0,0 +1,60 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRetryAfter caps how long a Retry-After header can make a retry wait
+const DefaultMaxRetryAfter = 30 * time.Second
+
+// parseRetryAfter reads a Retry-After header in either the delay-seconds or
+// the HTTP-date form (RFC 7231 7.1.3)
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// retryWait is the wait before the next attempt: the Retry-After delay,
+// capped by max, when the server sent one, the backoff otherwise
+func retryWait(backoff time.Duration, retryAfter time.Duration, hasRetryAfter bool, max time.Duration) time.Duration {
+	if !hasRetryAfter {
+		return backoff
+	}
+
+	if max <= 0 {
+		max = DefaultMaxRetryAfter
+	}
+	if retryAfter > max {
+		return max
+	}
+	return retryAfter
+}
@@ -0,0 +1,116 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type retryAfterSuite struct{}
+
+var _ = check.Suite(&retryAfterSuite{})
+
+func (s *retryAfterSuite) TestParseRetryAfter(c *check.C) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter(http.Header{"Retry-After": {"120"}}, now)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(delay, check.Equals, 2*time.Minute)
+
+	delay, ok = parseRetryAfter(http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:30 GMT"}}, now)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(delay, check.Equals, 30*time.Second)
+
+	delay, ok = parseRetryAfter(http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:27:00 GMT"}}, now)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(delay, check.Equals, time.Duration(0))
+
+	for _, value := range []string{"", "-1", "soon"} {
+		_, ok = parseRetryAfter(http.Header{"Retry-After": {value}}, now)
+		c.Assert(ok, check.Equals, false)
+	}
+}
+
+func (s *retryAfterSuite) TestRetryWait(c *check.C) {
+	c.Assert(retryWait(time.Second, 0, false, time.Minute), check.Equals, time.Second)
+	c.Assert(retryWait(time.Second, 5*time.Second, true, time.Minute), check.Equals, 5*time.Second)
+	c.Assert(retryWait(time.Second, time.Hour, true, time.Minute), check.Equals, time.Minute)
+	c.Assert(retryWait(time.Second, time.Hour, true, 0), check.Equals, DefaultMaxRetryAfter)
+}
+
+func (s *retryAfterSuite) TestClientHonorsRetryAfter(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	start := time.Now()
+	resp, err := client.Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(time.Since(start) >= time.Second, check.Equals, true)
+}
+
+func (s *retryAfterSuite) TestClientCapsRetryAfter(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	client.Options.MaxRetryAfter = 50 * time.Millisecond
+	start := time.Now()
+	resp, err := client.Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+}
+
+func (s *retryAfterSuite) TestTokenManagerRetryAfter(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.MaxRetryAfter = 100 * time.Millisecond
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	start := time.Now()
+	_, err := tm.GetToken()
+	c.Assert(time.Since(start) >= 100*time.Millisecond, check.Equals, true)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(DefaultTokenMaxRetries))
+
+	var endpointErr *TokenEndpointError
+	c.Assert(errors.As(err, &endpointErr), check.Equals, true)
+	c.Assert(endpointErr.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(endpointErr.RetryAfter, check.Equals, time.Second)
+	c.Assert(endpointErr.Error(), check.Matches, ".*retryAfter: 1s")
+}
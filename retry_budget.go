@@ -0,0 +1,59 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import "sync"
+
+type (
+	// RetryBudget limits retries to a ratio of the requests sent, so a
+	// struggling service is not hit by a retry storm. It is a token bucket:
+	// every request deposits Ratio tokens, up to a maximum, and every retry
+	// withdraws one. Share a budget between Clients, through their
+	// ClientOptions, to enforce it across all of them.
+	RetryBudget struct {
+		ratio     float64
+		maxTokens float64
+		tokens    float64
+		mutex     *sync.Mutex
+	}
+)
+
+// NewRetryBudget allows ratio retries per request, e.g. 0.1 for one retry
+// every ten requests, with a burst of up to maxRetries retries
+func NewRetryBudget(ratio float64, maxRetries int) *RetryBudget {
+	return &RetryBudget{
+		ratio:     ratio,
+		maxTokens: float64(maxRetries),
+		tokens:    float64(maxRetries),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// deposit credits the budget for a new request
+func (rb *RetryBudget) deposit() {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	rb.tokens += rb.ratio
+	if rb.tokens > rb.maxTokens {
+		rb.tokens = rb.maxTokens
+	}
+}
+
+// withdraw takes a token for a retry, reporting false when the budget is exhausted
+func (rb *RetryBudget) withdraw() bool {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
@@ -0,0 +1,106 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type retryBudgetSuite struct{}
+
+var _ = check.Suite(&retryBudgetSuite{})
+
+func (s *retryBudgetSuite) TestRetryBudget(c *check.C) {
+	budget := NewRetryBudget(0.5, 2)
+
+	c.Assert(budget.withdraw(), check.Equals, true)
+	c.Assert(budget.withdraw(), check.Equals, true)
+	c.Assert(budget.withdraw(), check.Equals, false)
+
+	budget.deposit()
+	c.Assert(budget.withdraw(), check.Equals, false)
+	budget.deposit()
+	c.Assert(budget.withdraw(), check.Equals, true)
+
+	for i := 0; i < 10; i++ {
+		budget.deposit()
+	}
+	c.Assert(budget.withdraw(), check.Equals, true)
+	c.Assert(budget.withdraw(), check.Equals, true)
+	c.Assert(budget.withdraw(), check.Equals, false)
+}
+
+func (s *retryBudgetSuite) TestClientStopsRetryingWhenBudgetExhausted(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	client.Options.RetryBudget = NewRetryBudget(0, 3)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ts.URL + "/feed/1")
+		c.Assert(err, check.IsNil)
+		c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	}
+
+	// 3 requests of up to 3 attempts, with 3 retries in the budget
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(6))
+}
+
+func (s *retryBudgetSuite) TestTotalTimeout(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(NewRetryPolicy())
+	client.Options.Backoff = ExponentialBackoff
+	client.Options.TotalTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	resp, err := client.Get(ts.URL + "/feed/1")
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(resp, check.IsNil)
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *retryBudgetSuite) TestTotalTimeoutKeepsBodyReadable(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"body": "test"}`))
+	})
+	defer ts.Close()
+
+	client := newRetryPolicyClient(nil)
+	client.Options.TotalTimeout = time.Second
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/feed/1", nil)
+	resp, err := client.DoRequest(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, `{"body": "test"}`)
+}
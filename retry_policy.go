@@ -0,0 +1,84 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+)
+
+type (
+	// RetryPolicy decides which failures, besides 401, are worth another
+	// attempt. Non-idempotent requests are only retried when the connection
+	// was refused, unless RetryNonIdempotent is set.
+	RetryPolicy struct {
+		// StatusCodes lists the response statuses retried, e.g. 429 and 503
+		StatusCodes []int
+		// NetworkErrors retries connection resets, refusals and timeouts
+		NetworkErrors bool
+		// RetryNonIdempotent also retries POST and PATCH requests
+		RetryNonIdempotent bool
+	}
+)
+
+// NewRetryPolicy returns a policy retrying network errors, 429, 502, 503 and 504
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		StatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		NetworkErrors: true,
+	}
+}
+
+func (rp *RetryPolicy) retryStatus(method string, statusCode int) bool {
+	if !rp.RetryNonIdempotent && !isIdempotent(method) {
+		return false
+	}
+
+	for _, code := range rp.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp *RetryPolicy) retryError(method string, err error) bool {
+	if !rp.NetworkErrors {
+		return false
+	}
+
+	// a refused connection never reached the server, so any method is safe
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	if !rp.RetryNonIdempotent && !isIdempotent(method) {
+		return false
+	}
+
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"gopkg.in/check.v1"
+)
+
+type retryPolicySuite struct{}
+
+var _ = check.Suite(&retryPolicySuite{})
+
+func newRetryPolicyClient(policy *RetryPolicy) *Client {
+	options := defaultClientOptions
+	options.MaxRetries = 3
+	options.RetryPolicy = policy
+	return NewClientCustom(&staticTokenManager{token: &Token{Authorization: "Bearer static"}}, options)
+}
+
+func handleFailures(requests *int32, failures int32, statusCode int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.WriteHeader(statusCode)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *retryPolicySuite) TestRetryStatus(c *check.C) {
+	for _, statusCode := range []int{429, 502, 503, 504} {
+		var requests int32
+		ts := newTestServerCustom(handleFailures(&requests, 2, statusCode))
+
+		resp, err := newRetryPolicyClient(NewRetryPolicy()).Get(ts.URL + "/feed/1")
+		ts.Close()
+		c.Assert(err, check.IsNil)
+		c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+		c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+	}
+}
+
+func (s *retryPolicySuite) TestRetryStatusGivesUp(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleFailures(&requests, 5, http.StatusServiceUnavailable))
+	defer ts.Close()
+
+	resp, err := newRetryPolicyClient(NewRetryPolicy()).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+}
+
+func (s *retryPolicySuite) TestNoRetryPolicy(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleFailures(&requests, 1, http.StatusServiceUnavailable))
+	defer ts.Close()
+
+	resp, err := newRetryPolicyClient(nil).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *retryPolicySuite) TestNonIdempotentNotRetried(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleFailures(&requests, 1, http.StatusServiceUnavailable))
+	defer ts.Close()
+
+	resp, err := newRetryPolicyClient(NewRetryPolicy()).Post(ts.URL+"/feed/1", `{"body": "test"}`)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *retryPolicySuite) TestNonIdempotentRetried(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleFailures(&requests, 1, http.StatusServiceUnavailable))
+	defer ts.Close()
+
+	policy := NewRetryPolicy()
+	policy.RetryNonIdempotent = true
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/feed/1", strings.NewReader(`{"body": "test"}`))
+	resp, err := newRetryPolicyClient(policy).DoRequest(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
+func (s *retryPolicySuite) TestRetryConnectionReset(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/feed/1", nil)
+	resp, err := newRetryPolicyClient(NewRetryPolicy()).DoRequest(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
+func (s *retryPolicySuite) TestRetryConnectionRefused(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {})
+	url := ts.URL
+	ts.Close()
+
+	policy := NewRetryPolicy()
+	c.Assert(policy.retryError(http.MethodPost, nil), check.Equals, false)
+
+	req, _ := http.NewRequest(http.MethodPost, url+"/feed/1", strings.NewReader(`{"body": "test"}`))
+	_, err := newRetryPolicyClient(policy).DoRequest(req)
+	c.Assert(err, check.NotNil)
+	c.Assert(policy.retryError(http.MethodPost, err), check.Equals, true)
+	c.Assert(policy.retryError(http.MethodGet, err), check.Equals, true)
+}
+
+func (s *retryPolicySuite) TestGetRetriesConnectionReset(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	resp, err := newRetryPolicyClient(NewRetryPolicy()).Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
+func (s *retryPolicySuite) TestGetRetriesConnectionRefused(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {})
+	url := ts.URL
+	ts.Close()
+
+	_, err := newRetryPolicyClient(NewRetryPolicy()).Get(url + "/feed/1")
+	c.Assert(errors.Is(err, syscall.ECONNREFUSED), check.Equals, true)
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.Attempts, check.Equals, 3)
+}
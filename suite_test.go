@@ -9,10 +9,18 @@
 package galf
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"gopkg.in/check.v1"
 )
@@ -30,6 +38,34 @@ func newTestServerCustom(handle func(w http.ResponseWriter, r *http.Request)) *h
 	return httptest.NewServer(http.HandlerFunc(handlerWrapper))
 }
 
+func newTestServerTLS(handle func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(handle))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	return ts
+}
+
+func newTestClientCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "galf"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
 func newTestServerToken(expireIn ...int) *httptest.Server {
 	expire := 15
 	if len(expireIn) > 0 {
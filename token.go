@@ -9,32 +9,75 @@
 package galf
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 	"time"
-
-	"github.com/facebookgo/stackerr"
 )
 
 type Token struct {
-	AccessToken   string `json:"access_token"`
-	TokenType     string `json:"token_type"`
-	ExpiresIn     int    `json:"expires_in"`
+	AccessToken   string        `json:"access_token"`
+	TokenType     string        `json:"token_type"`
+	ExpiresIn     int           `json:"expires_in"`
+	RefreshToken  string        `json:"refresh_token"`
+	Scope         string        `json:"scope"`
+	Confirmation  *Confirmation `json:"cnf,omitempty"`
 	Authorization string
 	expiresOn     time.Time
 }
 
+// Confirmation holds the key a token is bound to
+type Confirmation struct {
+	X5tS256 string `json:"x5t#S256"`
+}
+
+// ExpiresOn returns the instant the token expires
+func (t *Token) ExpiresOn() time.Time {
+	return t.expiresOn
+}
+
+// TTL returns how long the token remains valid, or zero once it has expired
+func (t *Token) TTL() time.Duration {
+	ttl := time.Until(t.expiresOn)
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// CertificateThumbprint returns the x5t#S256 thumbprint of the certificate
+// a mutual TLS bound token is bound to, or an empty string
+func (t *Token) CertificateThumbprint() string {
+	if t.Confirmation == nil {
+		return ""
+	}
+	return t.Confirmation.X5tS256
+}
+
+// Scopes returns the scopes granted to the token
+func (t *Token) Scopes() []string {
+	return strings.Fields(t.Scope)
+}
+
 func (t *Token) isValid() bool {
-	return time.Now().Before(t.expiresOn)
+	return t.isValidFor(0)
+}
+
+// isValidFor reports whether the token is still valid skew from now
+func (t *Token) isValidFor(skew time.Duration) bool {
+	return time.Now().Add(skew).Before(t.expiresOn)
 }
 
 func newToken(body io.Reader) (*Token, error) {
 	var token Token
-	err := json.NewDecoder(body).Decode(&token)
-	if err != nil {
-		return nil, stackerr.Wrap(err)
+	if err := json.NewDecoder(body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	if token.Confirmation == nil {
+		token.Confirmation = jwtConfirmation(token.AccessToken)
 	}
 
 	token.TokenType = strings.Title(token.TokenType)
@@ -42,3 +85,25 @@ func newToken(body io.Reader) (*Token, error) {
 	token.Authorization = fmt.Sprintf("%s %s", token.TokenType, token.AccessToken)
 	return &token, nil
 }
+
+// jwtConfirmation reads the cnf claim of access tokens issued as JWTs; the
+// signature is not verified since only the resource server relies on it
+func jwtConfirmation(accessToken string) *Confirmation {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	var claims struct {
+		Confirmation *Confirmation `json:"cnf"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims.Confirmation
+}
@@ -9,18 +9,34 @@
 package galf
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
-	"github.com/facebookgo/stackerr"
-	"github.com/globocom/goreq"
 )
 
 const (
-	grantType = "grant_type=client_credentials"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypePassword          = "password"
+
+	minRefreshDelay = 100 * time.Millisecond
+	// the background refresher retries failures within these bounds, so a
+	// fast backoff cannot turn it into a retry storm
+	minRefreshRetryDelay = time.Second
+	maxRefreshRetryDelay = time.Minute
 )
 
 type (
@@ -29,14 +45,39 @@ type (
 		ResetToken()
 	}
 
+	// ContextTokenManager is a TokenManager whose token requests can be canceled
+	ContextTokenManager interface {
+		TokenManager
+		GetTokenContext(ctx context.Context) (*Token, error)
+	}
+
 	OAuthTokenManager struct {
 		TokenEndPoint string
 		ClientId      string
 		ClientSecret  string
 		Authorization string
 		Options       TokenOptions
-		token         *Token
-		mutex         *sync.Mutex
+		grant         url.Values
+		httpClient    *http.Client
+		token         atomic.Value // *Token
+		flight        *tokenFlight
+		stop          context.CancelFunc
+		stopped       chan struct{}
+	}
+
+	// tokenFlight runs one token request at a time, sharing its result with
+	// every caller waiting on it
+	tokenFlight struct {
+		mutex    sync.Mutex // guards inflight
+		inflight *tokenCall
+	}
+
+	// tokenCall is a token request in flight, shared by every caller waiting on it
+	tokenCall struct {
+		done     chan struct{}
+		token    *Token
+		err      error
+		canceled bool
 	}
 )
 
@@ -49,93 +90,312 @@ func SetDefaultTokenManager(tokenManager TokenManager) {
 }
 
 func NewTokenManager(tokenEndPoint string, clientId string, clientSecret string, options ...TokenOptions) *OAuthTokenManager {
+	grant := url.Values{"grant_type": {grantTypeClientCredentials}}
+	return newTokenManager(tokenEndPoint, clientId, clientSecret, grant, options...)
+}
+
+// NewPasswordTokenManager creates a token manager that authenticates with the
+// resource owner password credentials grant; scope is omitted when empty
+func NewPasswordTokenManager(tokenEndPoint string, clientId string, clientSecret string, username string, password string, scope string, options ...TokenOptions) *OAuthTokenManager {
+	grant := url.Values{
+		"grant_type": {grantTypePassword},
+		"username":   {username},
+		"password":   {password},
+	}
+	if scope != "" {
+		grant.Set("scope", scope)
+	}
+	return newTokenManager(tokenEndPoint, clientId, clientSecret, grant, options...)
+}
+
+func newTokenManager(tokenEndPoint string, clientId string, clientSecret string, grant url.Values, options ...TokenOptions) *OAuthTokenManager {
 	tokenOptions := defaultTokenOptions
 	if len(options) > 0 {
 		tokenOptions = options[0]
 	}
+	// retries, and the background refresher after a failure, call Backoff
+	if tokenOptions.Backoff == nil {
+		tokenOptions.Backoff = defaultTokenOptions.Backoff
+	}
 
-	authorization := "Basic " + base64.StdEncoding.EncodeToString([]byte(clientId+":"+clientSecret))
+	var authorization string
+	if tokenOptions.authMethod() == ClientSecretBasic {
+		credentials := clientId + ":" + clientSecret
+		if tokenOptions.EscapeBasicCredentials {
+			// RFC 6749 2.3.1: credentials are form-urlencoded before being base64 encoded
+			credentials = url.QueryEscape(clientId) + ":" + url.QueryEscape(clientSecret)
+		}
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
 	tm := &OAuthTokenManager{
 		TokenEndPoint: tokenEndPoint,
 		ClientId:      clientId,
 		ClientSecret:  clientSecret,
 		Authorization: authorization,
 		Options:       tokenOptions,
-		mutex:         &sync.Mutex{},
+		grant:         grant,
+		httpClient:    tokenOptions.newHTTPClient(),
+		flight:        &tokenFlight{},
+	}
+
+	if tokenOptions.BackgroundRefresh {
+		var ctx context.Context
+		ctx, tm.stop = context.WithCancel(context.Background())
+		tm.stopped = make(chan struct{})
+		go tm.refresher(ctx)
 	}
 
 	return tm
 }
 
 func (tm *OAuthTokenManager) GetToken() (*Token, error) {
-	var err error
+	return tm.GetTokenContext(context.Background())
+}
 
-	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
-	if tm.isValid() {
-		return tm.token, nil
+func (tm *OAuthTokenManager) GetTokenContext(ctx context.Context) (*Token, error) {
+	if token := tm.validToken(); token != nil {
+		return token, nil
 	}
+	return tm.refresh(ctx, false)
+}
 
-	for i := 1; i <= tm.Options.MaxRetries; i++ {
+func (tm *OAuthTokenManager) ResetToken() {
+	tm.token.Store((*Token)(nil))
+}
 
-		if tm.isValid() {
-			return tm.token, nil
-		}
+// Stop shuts down the background refresher, if any, and waits for it to return
+func (tm *OAuthTokenManager) Stop() {
+	if tm.stop == nil {
+		return
+	}
+	tm.stop()
+	<-tm.stopped
+}
+
+func (tm *OAuthTokenManager) refresher(ctx context.Context) {
+	defer close(tm.stopped)
 
-		tm.token, err = tm.do()
+	var delay time.Duration
+	failures := 0
+	for {
+		if sleep(ctx, delay) != nil {
+			return
+		}
 
-		if err != nil && i < tm.Options.MaxRetries {
-			time.Sleep(tm.Options.Backoff(i))
+		token, err := tm.refresh(ctx, true)
+		if err != nil {
+			// retrying cannot fix it; GetToken still fetches on demand
+			if isPermanent(err) {
+				return
+			}
+			failures++
+			delay = tm.Options.refreshRetryDelay(failures)
 			continue
 		}
 
-		return tm.token, err
+		failures = 0
+		delay = tm.Options.refreshDelay(token.ExpiresIn)
 	}
+}
 
-	return tm.token, err
+// refresh fetches a new token, or waits for the fetch already in flight and
+// shares its result. Unless force is set, as by the refresher renewing a token
+// still valid, a token stored by a fetch that completed since the caller
+// checked is returned instead.
+func (tm *OAuthTokenManager) refresh(ctx context.Context, force bool) (*Token, error) {
+	valid := tm.validToken
+	if force {
+		valid = nil
+	}
+
+	return tm.flight.do(ctx, valid, func(ctx context.Context) (*Token, error) {
+		token, err := tm.fetch(ctx, tm.grantForm())
+		if err == nil {
+			tm.token.Store(token)
+		}
+		return token, err
+	})
 }
 
-func (tm *OAuthTokenManager) ResetToken() {
-	tm.token = nil
+// do returns the token of valid, when set and not nil, or runs fetch, or
+// waits for the fetch already in flight and shares its result. No lock is
+// held while fetch runs, so waiting callers still return on ctx.Done and
+// valid tokens keep being served; fetch stores the token itself.
+func (f *tokenFlight) do(ctx context.Context, valid func() *Token, fetch func(ctx context.Context) (*Token, error)) (*Token, error) {
+	f.mutex.Lock()
+	if valid != nil {
+		if token := valid(); token != nil {
+			f.mutex.Unlock()
+			return token, nil
+		}
+	}
+	if call := f.inflight; call != nil {
+		f.mutex.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// the caller that started the fetch gave up, try again on our own
+		if call.canceled && ctx.Err() == nil {
+			return f.do(ctx, valid, fetch)
+		}
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	f.inflight = call
+	f.mutex.Unlock()
+
+	call.token, call.err = fetch(ctx)
+	call.canceled = ctx.Err() != nil
+
+	f.mutex.Lock()
+	f.inflight = nil
+	f.mutex.Unlock()
+	close(call.done)
+
+	return call.token, call.err
+}
+
+// validToken returns the current token if it is still valid, or nil
+func (tm *OAuthTokenManager) validToken() *Token {
+	token, _ := tm.token.Load().(*Token)
+	if token == nil || !token.isValidFor(tm.Options.ExpirySkew) {
+		return nil
+	}
+	return token
+}
+
+func (tm *OAuthTokenManager) grantForm() url.Values {
+	form := url.Values{}
+	for name, values := range tm.grant {
+		form[name] = append([]string(nil), values...)
+	}
+	return form
 }
 
-func (tm *OAuthTokenManager) isValid() bool {
-	return tm.token != nil && tm.token.isValid()
+// fetch requests a token with the given form, retrying with backoff on failure
+func (tm *OAuthTokenManager) fetch(ctx context.Context, form url.Values) (token *Token, err error) {
+	tm.Options.addParams(form)
+	switch tm.Options.authMethod() {
+	case ClientSecretPost:
+		form.Set("client_id", tm.ClientId)
+		form.Set("client_secret", tm.ClientSecret)
+	case TLSClientAuth:
+		form.Set("client_id", tm.ClientId)
+	}
+	for i := 1; ; i++ {
+		if token, err = tm.do(ctx, form); err == nil {
+			return token, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if isPermanent(err) {
+			return nil, err
+		}
+
+		var endpointErr *TokenEndpointError
+		isEndpointErr := errors.As(err, &endpointErr)
+		if i >= tm.Options.MaxRetries {
+			exhausted := &RetriesExhaustedError{Attempts: i, Err: err}
+			if isEndpointErr {
+				exhausted.StatusCode = endpointErr.StatusCode
+				exhausted.RetryAfter = endpointErr.RetryAfter
+			}
+			return nil, exhausted
+		}
+
+		wait := tm.Options.Backoff(i)
+		if isEndpointErr && endpointErr.RetryAfter > 0 {
+			wait = retryWait(wait, endpointErr.RetryAfter, true, tm.Options.MaxRetryAfter)
+		}
+		if err = sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isPermanent reports whether a token request failed in a way another attempt
+// cannot fix; an endpoint asking to retry through Retry-After never does
+func isPermanent(err error) bool {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return true
+	}
+
+	var endpointErr *TokenEndpointError
+	if errors.As(err, &endpointErr) && endpointErr.RetryAfter > 0 {
+		return false
+	}
+
+	var oauthErr *OAuthError
+	return errors.As(err, &oauthErr) && oauthErr.Permanent()
 }
 
-func (tm *OAuthTokenManager) do() (token *Token, err error) {
-	var resp *goreq.Response
+func (tm *OAuthTokenManager) do(ctx context.Context, form url.Values) (token *Token, err error) {
+	if tm.Options.authMethod() == PrivateKeyJWT {
+		// a new assertion on every attempt, so jti and exp are never reused
+		var assertion string
+		if assertion, err = newClientAssertion(tm.ClientId, tm.TokenEndPoint, tm.Options.PrivateKey, tm.Options.KeyID); err != nil {
+			return nil, err
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	}
+
+	var resp *http.Response
 	if tm.Options.HystrixConfig == nil {
-		if resp, err = tm.request(); err != nil {
+		if resp, err = tm.request(ctx, form); err != nil {
 			return nil, err
 		}
 	} else {
 		if err = tm.Options.HystrixConfig.valid(); err != nil {
 			return nil, err
 		}
-		if resp, err = tm.requestHystrix(); err != nil {
+		if resp, err = tm.requestHystrix(ctx, form); err != nil {
 			return nil, err
 		}
 	}
 
 	defer resp.Body.Close() // nolint: errcheck
 	if token, err = newToken(resp.Body); err != nil {
+		return nil, &TokenEndpointError{URL: tm.TokenEndPoint, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	// scope may be omitted when the granted scope is the requested one (RFC 6749 5.1)
+	if token.Scope == "" {
+		token.Scope = form.Get("scope")
+	}
+
+	if err = verifyCertificateBinding(tm.Options.TLSConfig, token); err != nil {
 		return nil, err
 	}
 
 	return token, nil
 }
 
-func (tm *OAuthTokenManager) requestHystrix() (*goreq.Response, error) {
+func (tm *OAuthTokenManager) requestHystrix(ctx context.Context, form url.Values) (*http.Response, error) {
+
+	output := make(chan *http.Response)
+	// closed once we stop waiting, so a late response is closed instead of
+	// leaking its connection
+	abandoned := make(chan struct{})
+	defer close(abandoned)
 
-	output := make(chan *goreq.Response, 1)
 	errors := hystrix.Go(tm.Options.HystrixConfig.Name, func() error {
 
-		resp, err := tm.request()
+		resp, err := tm.request(ctx, form)
 		if err != nil {
 			return err
 		}
-		output <- resp
+		select {
+		case output <- resp:
+		case <-abandoned:
+			resp.Body.Close() // nolint:errcheck
+		}
 
 		return nil
 	}, nil)
@@ -144,40 +404,61 @@ func (tm *OAuthTokenManager) requestHystrix() (*goreq.Response, error) {
 	case out := <-output:
 		return out, nil
 	case err := <-errors:
-		return nil, err
+		return nil, tm.Options.HystrixConfig.circuitError(err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-func (tm *OAuthTokenManager) request() (*goreq.Response, error) {
+func (tm *OAuthTokenManager) request(ctx context.Context, form url.Values) (*http.Response, error) {
 
-	client := goreq.NewClient(goreq.Options{
-		Timeout: tm.Options.Timeout,
-	})
+	req, err := http.NewRequest(http.MethodPost, tm.TokenEndPoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, &ConfigError{Message: "Invalid token endpoint", Err: err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if tm.Authorization != "" {
+		req.Header.Set("Authorization", tm.Authorization)
+	}
 
-	req := goreq.Request{
-		Method:      "POST",
-		ContentType: "application/x-www-form-urlencoded",
-		Uri:         tm.TokenEndPoint,
-		Body:        grantType,
-		ShowDebug:   tm.Options.ShowDebug,
+	if tm.Options.ShowDebug {
+		if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+			log.Println(string(dump))
+		}
 	}
-	req.AddHeader("Authorization", tm.Authorization)
 
-	resp, err := client.Do(req)
+	resp, err := tm.httpClient.Do(req)
 
 	if err != nil {
-		return nil, stackerr.Wrap(err)
+		return nil, &TokenEndpointError{URL: tm.TokenEndPoint, Err: err}
 	}
 
 	if resp.StatusCode >= 300 {
-		var body string
-		if body, err = resp.Body.ToString(); err != nil {
-			return nil, stackerr.Wrap(err)
+		defer resp.Body.Close() // nolint:errcheck
+
+		endpointErr := &TokenEndpointError{URL: tm.TokenEndPoint, StatusCode: resp.StatusCode}
+
+		var body []byte
+		if body, err = ioutil.ReadAll(resp.Body); err != nil {
+			endpointErr.Err = err
+			return nil, endpointErr
+		}
+
+		retryAfter, hasRetryAfter := parseRetryAfter(resp.Header, time.Now())
+		endpointErr.RetryAfter = retryAfter
+
+		if oauthErr := parseOAuthError(resp.StatusCode, body); oauthErr != nil {
+			endpointErr.Err = oauthErr
+			return nil, endpointErr
 		}
-		resp.Body.Close() // nolint:errcheck
 
 		erroMsg := fmt.Sprintf("Failed to request token url: %s - statusCode: %d - body: %s", resp.Request.URL, resp.StatusCode, body)
-		return nil, NewHttpError(resp.StatusCode, erroMsg)
+		if hasRetryAfter {
+			erroMsg += fmt.Sprintf(" - retryAfter: %s", retryAfter)
+		}
+		endpointErr.Err = NewHttpError(resp.StatusCode, erroMsg)
+		return nil, endpointErr
 	}
 	return resp, nil
 }
@@ -0,0 +1,171 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"sync"
+)
+
+type (
+	// AuthorizationCodeTokenManager exchanges an authorization code for tokens
+	// and renews the access token through the refresh_token grant
+	AuthorizationCodeTokenManager struct {
+		RedirectURI  string
+		endpoint     *OAuthTokenManager
+		token        *Token
+		refreshToken string
+		mutex        *sync.Mutex // guards token and refreshToken, never held while fetching
+		flight       *tokenFlight
+	}
+)
+
+func NewAuthorizationCodeTokenManager(tokenEndPoint string, clientId string, clientSecret string, redirectURI string, options ...TokenOptions) *AuthorizationCodeTokenManager {
+	tokenOptions := defaultTokenOptions
+	if len(options) > 0 {
+		tokenOptions = options[0]
+	}
+	tokenOptions.BackgroundRefresh = false
+
+	return &AuthorizationCodeTokenManager{
+		RedirectURI: redirectURI,
+		endpoint:    NewTokenManager(tokenEndPoint, clientId, clientSecret, tokenOptions),
+		mutex:       &sync.Mutex{},
+		flight:      &tokenFlight{},
+	}
+}
+
+// Exchange trades an authorization code, and the PKCE code verifier used to
+// obtain it if any, for an access token and a refresh token
+func (tm *AuthorizationCodeTokenManager) Exchange(code string, codeVerifier string) (*Token, error) {
+	return tm.ExchangeContext(context.Background(), code, codeVerifier)
+}
+
+func (tm *AuthorizationCodeTokenManager) ExchangeContext(ctx context.Context, code string, codeVerifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type": {grantTypeAuthorizationCode},
+		"code":       {code},
+	}
+	if tm.RedirectURI != "" {
+		form.Set("redirect_uri", tm.RedirectURI)
+	}
+	if codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+
+	return tm.store(tm.endpoint.fetch(ctx, form))
+}
+
+// GetToken returns the current access token, using the refresh token to
+// obtain a new one once it has expired
+func (tm *AuthorizationCodeTokenManager) GetToken() (*Token, error) {
+	return tm.GetTokenContext(context.Background())
+}
+
+func (tm *AuthorizationCodeTokenManager) GetTokenContext(ctx context.Context) (*Token, error) {
+	if token := tm.validToken(); token != nil {
+		return token, nil
+	}
+	return tm.flight.do(ctx, tm.validToken, tm.refresh)
+}
+
+// refresh obtains a new access token through the refresh_token grant
+func (tm *AuthorizationCodeTokenManager) refresh(ctx context.Context) (*Token, error) {
+	refreshToken := tm.RefreshToken()
+	if refreshToken == "" {
+		return nil, TokenExpiredError
+	}
+
+	form := url.Values{
+		"grant_type":    {grantTypeRefreshToken},
+		"refresh_token": {refreshToken},
+	}
+	token, err := tm.endpoint.fetch(ctx, form)
+	if err != nil && isPermanent(err) {
+		// replaying a revoked or expired refresh token cannot succeed, unless
+		// another one was set meanwhile
+		tm.mutex.Lock()
+		if tm.refreshToken == refreshToken {
+			tm.refreshToken = ""
+		}
+		tm.mutex.Unlock()
+		err = &RefreshTokenError{Err: err}
+	}
+	return tm.store(token, err)
+}
+
+// validToken returns the current access token if it is still valid, or nil
+func (tm *AuthorizationCodeTokenManager) validToken() *Token {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if tm.token == nil || !tm.token.isValidFor(tm.endpoint.Options.ExpirySkew) {
+		return nil
+	}
+	return tm.token
+}
+
+// ResetToken discards the access token; the refresh token is kept so the
+// next GetToken call can renew it
+func (tm *AuthorizationCodeTokenManager) ResetToken() {
+	tm.mutex.Lock()
+	tm.token = nil
+	tm.mutex.Unlock()
+}
+
+// RefreshToken returns the refresh token currently held by the manager
+func (tm *AuthorizationCodeTokenManager) RefreshToken() string {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.refreshToken
+}
+
+// SetRefreshToken restores a previously persisted refresh token
+func (tm *AuthorizationCodeTokenManager) SetRefreshToken(refreshToken string) {
+	tm.mutex.Lock()
+	tm.refreshToken = refreshToken
+	tm.token = nil
+	tm.mutex.Unlock()
+}
+
+func (tm *AuthorizationCodeTokenManager) store(token *Token, err error) (*Token, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if err != nil {
+		tm.token = nil
+		return nil, err
+	}
+
+	// the endpoint may omit refresh_token when it does not rotate it
+	if token.RefreshToken != "" {
+		tm.refreshToken = token.RefreshToken
+	}
+	tm.token = token
+	return token, nil
+}
+
+// NewCodeVerifier generates a random PKCE code verifier (RFC 7636)
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 derives the S256 PKCE code challenge of a code verifier
+func CodeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
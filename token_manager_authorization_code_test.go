@@ -0,0 +1,149 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+type authorizationCodeTokenManagerSuite struct{}
+
+var _ = check.Suite(&authorizationCodeTokenManagerSuite{})
+
+func handleAuthorizationCodeToken(c *check.C, grants *[]string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		grantType := r.PostForm.Get("grant_type")
+		*grants = append(*grants, grantType)
+
+		switch grantType {
+		case "authorization_code":
+			c.Assert(r.PostForm.Get("code"), check.Equals, "the-code")
+			c.Assert(r.PostForm.Get("code_verifier"), check.Equals, "the-verifier")
+			c.Assert(r.PostForm.Get("redirect_uri"), check.Equals, "https://app/callback")
+			fmt.Fprint(w, `{"access_token": "first", "token_type": "bearer", "expires_in": 0, "refresh_token": "refresh-1", "scope": "read"}`)
+		case "refresh_token":
+			c.Assert(r.PostForm.Get("refresh_token"), check.Equals, "refresh-1")
+			fmt.Fprint(w, `{"access_token": "second", "token_type": "bearer", "expires_in": 100, "scope": "read"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+func (s *authorizationCodeTokenManagerSuite) TestExchangeAndRefresh(c *check.C) {
+	var grants []string
+	ts := newTestServerCustom(handleAuthorizationCodeToken(c, &grants))
+	defer ts.Close()
+
+	tm := NewAuthorizationCodeTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		"https://app/callback",
+	)
+
+	token, err := tm.Exchange("the-code", "the-verifier")
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "first")
+	c.Assert(token.RefreshToken, check.Equals, "refresh-1")
+	c.Assert(token.Scope, check.Equals, "read")
+
+	token, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "second")
+	c.Assert(tm.RefreshToken(), check.Equals, "refresh-1")
+
+	token, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "second")
+	c.Assert(grants, check.DeepEquals, []string{"authorization_code", "refresh_token"})
+}
+
+func (s *authorizationCodeTokenManagerSuite) TestGetTokenWithoutRefreshToken(c *check.C) {
+	tm := NewAuthorizationCodeTokenManager(
+		"http://localhost/token",
+		"ClientId",
+		"ClientSecret",
+		"https://app/callback",
+	)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.Equals, TokenExpiredError)
+	c.Assert(token, check.IsNil)
+}
+
+func (s *authorizationCodeTokenManagerSuite) TestRevokedRefreshToken(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleOAuthError(&requests, http.StatusBadRequest, `{"error": "invalid_grant"}`))
+	defer ts.Close()
+
+	tm := NewAuthorizationCodeTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", "https://app/callback")
+	tm.SetRefreshToken("revoked")
+
+	_, err := tm.GetToken()
+	c.Assert(errors.Is(err, ErrAuthorizationRequired), check.Equals, true)
+	var oauthErr *OAuthError
+	c.Assert(errors.As(err, &oauthErr), check.Equals, true)
+	c.Assert(oauthErr.Code, check.Equals, OAuthInvalidGrant)
+	c.Assert(tm.RefreshToken(), check.Equals, "")
+
+	_, err = tm.GetToken()
+	c.Assert(err, check.Equals, TokenExpiredError)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *authorizationCodeTokenManagerSuite) TestWaitingCallerHonoursContext(c *check.C) {
+	var requests int32
+	release := make(chan struct{})
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		fmt.Fprint(w, `{"access_token": "slow", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewAuthorizationCodeTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", "https://app/callback")
+	tm.SetRefreshToken("refresh-1")
+	fetched := make(chan *Token)
+	go func() {
+		token, _ := tm.GetToken()
+		fetched <- token
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := tm.GetTokenContext(ctx)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < 200*time.Millisecond, check.Equals, true)
+	c.Assert(tm.RefreshToken(), check.Equals, "refresh-1")
+
+	close(release)
+	c.Assert((<-fetched).AccessToken, check.Equals, "slow")
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *authorizationCodeTokenManagerSuite) TestCodeChallengeS256(c *check.C) {
+	// example from RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	c.Assert(CodeChallengeS256(verifier), check.Equals, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+
+	verifier, err := NewCodeVerifier()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(verifier), check.Equals, 43)
+}
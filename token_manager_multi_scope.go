@@ -0,0 +1,131 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// ScopedTokenManager is a TokenManager able to issue tokens for a given set of scopes
+	ScopedTokenManager interface {
+		TokenManager
+		GetScopedToken(scopes []string) (*Token, error)
+		GetScopedTokenContext(ctx context.Context, scopes []string) (*Token, error)
+		ResetScopedToken(scopes []string)
+	}
+
+	// MultiScopeTokenManager caches one client credentials token per scope set,
+	// sharing the token endpoint configuration between them
+	MultiScopeTokenManager struct {
+		endpoint *OAuthTokenManager
+		tokens   map[string]*scopedToken
+		mutex    *sync.Mutex
+	}
+
+	scopedToken struct {
+		token  atomic.Value // *Token
+		flight tokenFlight
+	}
+)
+
+func NewMultiScopeTokenManager(tokenEndPoint string, clientId string, clientSecret string, options ...TokenOptions) *MultiScopeTokenManager {
+	tokenOptions := defaultTokenOptions
+	if len(options) > 0 {
+		tokenOptions = options[0]
+	}
+	tokenOptions.BackgroundRefresh = false
+
+	return &MultiScopeTokenManager{
+		endpoint: NewTokenManager(tokenEndPoint, clientId, clientSecret, tokenOptions),
+		tokens:   make(map[string]*scopedToken),
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// GetToken returns the token for the scopes configured in TokenOptions
+func (tm *MultiScopeTokenManager) GetToken() (*Token, error) {
+	return tm.GetScopedTokenContext(context.Background(), nil)
+}
+
+func (tm *MultiScopeTokenManager) GetTokenContext(ctx context.Context) (*Token, error) {
+	return tm.GetScopedTokenContext(ctx, nil)
+}
+
+// ResetToken discards the token for the scopes configured in TokenOptions
+func (tm *MultiScopeTokenManager) ResetToken() {
+	tm.ResetScopedToken(nil)
+}
+
+func (tm *MultiScopeTokenManager) GetScopedToken(scopes []string) (*Token, error) {
+	return tm.GetScopedTokenContext(context.Background(), scopes)
+}
+
+func (tm *MultiScopeTokenManager) GetScopedTokenContext(ctx context.Context, scopes []string) (*Token, error) {
+	entry := tm.entry(scopeKey(scopes))
+	valid := func() *Token {
+		token, _ := entry.token.Load().(*Token)
+		if token == nil || !token.isValidFor(tm.endpoint.Options.ExpirySkew) {
+			return nil
+		}
+		return token
+	}
+	if token := valid(); token != nil {
+		return token, nil
+	}
+
+	return entry.flight.do(ctx, valid, func(ctx context.Context) (*Token, error) {
+		form := url.Values{"grant_type": {grantTypeClientCredentials}}
+		if len(scopes) > 0 {
+			form.Set("scope", scopeKey(scopes))
+		}
+
+		token, err := tm.endpoint.fetch(ctx, form)
+		entry.token.Store(token)
+		return token, err
+	})
+}
+
+func (tm *MultiScopeTokenManager) ResetScopedToken(scopes []string) {
+	tm.entry(scopeKey(scopes)).token.Store((*Token)(nil))
+}
+
+func (tm *MultiScopeTokenManager) entry(key string) *scopedToken {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	entry, exists := tm.tokens[key]
+	if !exists {
+		entry = &scopedToken{}
+		tm.tokens[key] = entry
+	}
+	return entry
+}
+
+// scopeKey normalizes a scope set so the same scopes in any order share a token
+func scopeKey(scopes []string) string {
+	unique := make(map[string]struct{}, len(scopes))
+	for _, scope := range scopes {
+		for _, s := range strings.Fields(scope) {
+			unique[s] = struct{}{}
+		}
+	}
+
+	sorted := make([]string, 0, len(unique))
+	for scope := range unique {
+		sorted = append(sorted, scope)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, " ")
+}
@@ -0,0 +1,142 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+type multiScopeTokenManagerSuite struct{}
+
+var _ = check.Suite(&multiScopeTokenManagerSuite{})
+
+func handleScopedToken(requests map[string]int, mutex *sync.Mutex) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		scope := r.PostForm.Get("scope")
+
+		mutex.Lock()
+		requests[scope]++
+		mutex.Unlock()
+
+		fmt.Fprintf(w, `{"access_token": "token-%s", "token_type": "bearer", "expires_in": 100}`, scope)
+	}
+}
+
+func (s *multiScopeTokenManagerSuite) TestTokenPerScopeSet(c *check.C) {
+	requests := map[string]int{}
+	mutex := &sync.Mutex{}
+	ts := newTestServerCustom(handleScopedToken(requests, mutex))
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.Scopes = []string{"default"}
+	tm := NewMultiScopeTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "token-default")
+
+	token, err = tm.GetScopedToken([]string{"write", "read"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "token-read write")
+	c.Assert(token.Scopes(), check.DeepEquals, []string{"read", "write"})
+
+	token, err = tm.GetScopedToken([]string{"read write"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "token-read write")
+
+	tm.ResetScopedToken([]string{"read", "write"})
+	_, err = tm.GetScopedToken([]string{"read", "write"})
+	c.Assert(err, check.IsNil)
+	_, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+
+	c.Assert(requests, check.DeepEquals, map[string]int{"default": 1, "read write": 2})
+}
+
+func (s *multiScopeTokenManagerSuite) TestWaitingCallerHonoursContext(c *check.C) {
+	var requests int32
+	release := make(chan struct{})
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		fmt.Fprint(w, `{"access_token": "slow", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewMultiScopeTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+	fetched := make(chan *Token)
+	go func() {
+		token, _ := tm.GetScopedToken([]string{"read"})
+		fetched <- token
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := tm.GetScopedTokenContext(ctx, []string{"read"})
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < 200*time.Millisecond, check.Equals, true)
+
+	close(release)
+	c.Assert((<-fetched).AccessToken, check.Equals, "slow")
+	token, err := tm.GetScopedToken([]string{"read"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.AccessToken, check.Equals, "slow")
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func (s *multiScopeTokenManagerSuite) TestClientRequestScopes(c *check.C) {
+	requests := map[string]int{}
+	mutex := &sync.Mutex{}
+	tokenServer := newTestServerCustom(handleScopedToken(requests, mutex))
+	defer tokenServer.Close()
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-feed:read" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	tm := NewMultiScopeTokenManager(tokenServer.URL+"/token", "ClientId", "ClientSecret")
+	client := NewClientCustom(tm, defaultClientOptions)
+
+	reqOptions := NewRequestOptions()
+	reqOptions.SetScopes("feed:read")
+	resp, err := client.Get(ts.URL+"/feed/1", reqOptions)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	resp, err = client.Get(ts.URL + "/feed/1")
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(requests, check.DeepEquals, map[string]int{"feed:read": 1, "": 2})
+}
+
+func (s *multiScopeTokenManagerSuite) TestClientRequestScopesUnsupported(c *check.C) {
+	client := NewClientCustom(NewTokenManager("http://localhost/token", "ClientId", "ClientSecret"), defaultClientOptions)
+
+	reqOptions := NewRequestOptions()
+	reqOptions.SetScopes("feed:read")
+	resp, err := client.Get("http://localhost/feed/1", reqOptions)
+	c.Assert(err, check.ErrorMatches, "TokenManager does not support request scopes")
+	c.Assert(resp, check.IsNil)
+}
@@ -8,20 +8,92 @@
 
 package galf
 
-import "time"
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTokenMaxRetries      = 2
+	DefaultTokenClientTimeout   = 1 * time.Second
+	DefaultTokenIdleConnTimeout = 90 * time.Second
+	DefaultTokenKeepAlive       = 30 * time.Second
+	DefaultTokenRefreshRatio    = 0.75
+	DefaultTokenRefreshJitter   = 0.1
+)
 
 const (
-	DefaultTokenMaxRetries    = 2
-	DefaultTokenClientTimeout = 1 * time.Second
+	// ClientSecretBasic sends the client credentials in a Basic Authorization header
+	ClientSecretBasic ClientAuthMethod = "client_secret_basic"
+	// ClientSecretPost sends the client credentials in the request body
+	ClientSecretPost ClientAuthMethod = "client_secret_post"
+	// PrivateKeyJWT sends a client assertion signed with PrivateKey (RFC 7523)
+	PrivateKeyJWT ClientAuthMethod = "private_key_jwt"
+	// TLSClientAuth authenticates with the client certificate of TLSConfig (RFC 8705)
+	TLSClientAuth ClientAuthMethod = "tls_client_auth"
 )
 
 type (
+	// ClientAuthMethod is how the client authenticates against the token endpoint
+	ClientAuthMethod string
+
 	TokenOptions struct {
 		Timeout       time.Duration
 		Backoff       BackoffStrategy
 		MaxRetries    int
 		ShowDebug     bool
 		HystrixConfig *HystrixConfig
+		// MaxRetryAfter caps the wait requested by a Retry-After header of the
+		// token endpoint, DefaultMaxRetryAfter when zero
+		MaxRetryAfter time.Duration
+
+		// AuthMethod defaults to ClientSecretBasic
+		AuthMethod ClientAuthMethod
+		// EscapeBasicCredentials form-urlencodes the client id and secret of
+		// ClientSecretBasic as RFC 6749 2.3.1 requires; they are sent as is
+		// otherwise, which providers that do not decode them expect
+		EscapeBasicCredentials bool
+		// PrivateKey signs the client assertions of PrivateKeyJWT, RSA keys use RS256 and P-256 keys ES256
+		PrivateKey crypto.Signer
+		// KeyID is sent as the kid header of the client assertions
+		KeyID string
+		// TLSConfig configures the connection to the token endpoint, e.g. the client certificate for mutual TLS
+		TLSConfig *tls.Config
+
+		// HTTPClient, when set, is used as is to reach the token endpoint
+		HTTPClient *http.Client
+		// Transport, when set, replaces the transport built from the settings below
+		Transport http.RoundTripper
+		// Proxy defaults to http.ProxyFromEnvironment
+		Proxy               func(*http.Request) (*url.URL, error)
+		MaxIdleConnsPerHost int
+		IdleConnTimeout     time.Duration
+		KeepAlive           time.Duration
+
+		// Scopes are requested from the token endpoint as a space-delimited scope parameter
+		Scopes []string
+		// Params are extra form parameters sent to the token endpoint, e.g. audience or resource
+		Params url.Values
+
+		// ExpirySkew treats tokens as expired this long before they actually expire
+		ExpirySkew time.Duration
+
+		// BackgroundRefresh starts a goroutine that renews the token before it
+		// expires; it gives up on permanent errors such as invalid_client
+		BackgroundRefresh bool
+		// RefreshRatio is the fraction of ExpiresIn after which the token is renewed
+		RefreshRatio float64
+		// RefreshJitter is the maximum fraction of the refresh delay randomly subtracted from it
+		RefreshJitter float64
 	}
 )
 
@@ -32,6 +104,8 @@ var (
 		Backoff:       ConstantBackOff,
 		ShowDebug:     false,
 		HystrixConfig: nil,
+		RefreshRatio:  DefaultTokenRefreshRatio,
+		RefreshJitter: DefaultTokenRefreshJitter,
 	}
 )
 
@@ -47,5 +121,135 @@ func NewTokenOptions(timeout time.Duration, debug bool, maxRetries int, circuitN
 		MaxRetries:    maxRetries,
 		Backoff:       tokenBackoff,
 		HystrixConfig: NewHystrixConfig(circuitName),
+		RefreshRatio:  DefaultTokenRefreshRatio,
+		RefreshJitter: DefaultTokenRefreshJitter,
+	}
+}
+
+func (to TokenOptions) refreshDelay(expiresIn int) time.Duration {
+	// without expires_in the token is never valid for long; refreshing it as
+	// soon as possible would hammer the endpoint
+	if expiresIn <= 0 {
+		return minRefreshRetryDelay
+	}
+
+	ratio := to.RefreshRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = DefaultTokenRefreshRatio
+	}
+
+	delay := float64(expiresIn) * float64(time.Second) * ratio
+	if to.RefreshJitter > 0 {
+		delay -= delay * to.RefreshJitter * rand.Float64()
+	}
+
+	if delay < float64(minRefreshDelay) {
+		return minRefreshDelay
+	}
+	return time.Duration(delay)
+}
+
+// refreshRetryDelay is the backoff of the background refresher after failures,
+// bounded by minRefreshRetryDelay and maxRefreshRetryDelay
+func (to TokenOptions) refreshRetryDelay(failures int) time.Duration {
+	delay := to.Backoff(failures)
+	if delay < minRefreshRetryDelay {
+		return minRefreshRetryDelay
+	}
+	if delay > maxRefreshRetryDelay {
+		return maxRefreshRetryDelay
+	}
+	return delay
+}
+
+// addParams adds the configured scopes and extra parameters to a token request
+// form, without overriding the parameters the grant already sets
+func (to TokenOptions) addParams(form url.Values) {
+	if len(to.Scopes) > 0 && form.Get("scope") == "" {
+		form.Set("scope", strings.Join(to.Scopes, " "))
+	}
+
+	for name, values := range to.Params {
+		if _, exists := form[name]; !exists {
+			form[name] = append([]string(nil), values...)
+		}
+	}
+}
+
+func (to TokenOptions) authMethod() ClientAuthMethod {
+	if to.AuthMethod == "" {
+		return ClientSecretBasic
+	}
+	return to.AuthMethod
+}
+
+// verifyCertificateBinding checks that a certificate-bound token (RFC 8705 3.1)
+// is bound to the client certificate of tlsConfig
+func verifyCertificateBinding(tlsConfig *tls.Config, token *Token) error {
+	thumbprint := token.CertificateThumbprint()
+	if thumbprint == "" || tlsConfig == nil || len(tlsConfig.Certificates) == 0 {
+		return nil
+	}
+
+	if expected := certificateThumbprint(tlsConfig.Certificates[0]); thumbprint != expected {
+		return &ConfigError{Message: fmt.Sprintf("Token is bound to certificate %s, expected %s", thumbprint, expected)}
+	}
+	return nil
+}
+
+// certificateThumbprint returns the base64url SHA-256 thumbprint of a certificate leaf
+func certificateThumbprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newHTTPClient builds the long-lived client used to reach the token endpoint
+func (to TokenOptions) newHTTPClient() *http.Client {
+	if to.HTTPClient != nil {
+		return to.HTTPClient
+	}
+
+	transport := to.Transport
+	if transport == nil {
+		transport = to.newTransport()
+	}
+
+	return &http.Client{
+		Timeout:   to.Timeout,
+		Transport: transport,
+	}
+}
+
+func (to TokenOptions) newTransport() *http.Transport {
+	proxy := to.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	keepAlive := to.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultTokenKeepAlive
+	}
+
+	idleConnTimeout := to.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = DefaultTokenIdleConnTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   to.Timeout,
+		KeepAlive: keepAlive,
+	}
+
+	return &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     to.TLSConfig,
+		TLSHandshakeTimeout: to.Timeout,
+		MaxIdleConnsPerHost: to.MaxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
 	}
 }
@@ -9,9 +9,28 @@
 package galf
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
 	check "gopkg.in/check.v1"
@@ -79,6 +98,34 @@ func (tms *tokenManagerSuite) TestTokenManagerInvalid(c *check.C) {
 	c.Assert(token.isValid(), check.Equals, false)
 }
 
+func (tms *tokenManagerSuite) TestTokenManagerExpirySkew(c *check.C) {
+	var requests int32
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 30}`)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.ExpirySkew = time.Minute
+
+	tm := NewTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		options,
+	)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.isValid(), check.Equals, true)
+
+	_, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
 func (tms *tokenManagerSuite) TestTokenManagerRetryFail(c *check.C) {
 	var retries = 0
 
@@ -188,6 +235,686 @@ func (tms *tokenManagerSuite) TestGetTokenConcurrencyCalls(c *check.C) {
 	}
 }
 
+func (tms *tokenManagerSuite) TestTokenManagerBackgroundRefresh(c *check.C) {
+	var requests int32
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 1}`)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.BackgroundRefresh = true
+	options.RefreshRatio = 0.5
+	options.RefreshJitter = 0
+
+	tm := NewTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		options,
+	)
+
+	time.Sleep(1200 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&requests) >= 2, check.Equals, true)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.isValid(), check.Equals, true)
+
+	tm.Stop()
+	tm.Stop()
+	stopped := atomic.LoadInt32(&requests)
+	time.Sleep(700 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, stopped)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerBackgroundRefreshStopsOnPermanentError(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleOAuthError(&requests, http.StatusUnauthorized, `{"error": "invalid_client"}`))
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.BackgroundRefresh = true
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "wrong", options)
+	defer tm.Stop()
+
+	time.Sleep(300 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+
+	select {
+	case <-tm.stopped:
+	default:
+		c.Fatal("refresher still running after a permanent error")
+	}
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerWithoutBackoff(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleOAuthError(&requests, http.StatusServiceUnavailable, ""))
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", TokenOptions{MaxRetries: 2, BackgroundRefresh: true})
+	defer tm.Stop()
+
+	_, err := tm.GetToken()
+	c.Assert(err, check.NotNil)
+	c.Assert(tm.Options.refreshRetryDelay(1), check.Equals, minRefreshRetryDelay)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerRefreshDelayBounds(c *check.C) {
+	options := defaultTokenOptions
+	c.Assert(options.refreshRetryDelay(1), check.Equals, minRefreshRetryDelay)
+
+	options.Backoff = ExponentialBackoff
+	c.Assert(options.refreshRetryDelay(2), check.Equals, 4*time.Second)
+	c.Assert(options.refreshRetryDelay(20), check.Equals, maxRefreshRetryDelay)
+
+	c.Assert(options.refreshDelay(0), check.Equals, minRefreshRetryDelay)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerStopWithoutBackgroundRefresh(c *check.C) {
+	tm := NewTokenManager("http://localhost/token", "ClientId", "ClientSecret")
+	tm.Stop()
+}
+
+func (tms *tokenManagerSuite) TestPasswordTokenManager(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "Basic Q2xpZW50SWQ6Q2xpZW50U2VjcmV0")
+		c.Assert(r.PostForm.Get("grant_type"), check.Equals, "password")
+		c.Assert(r.PostForm.Get("username"), check.Equals, "user@globo.com")
+		c.Assert(r.PostForm.Get("password"), check.Equals, "p&ss=word")
+		c.Assert(r.PostForm.Get("scope"), check.Equals, "read write")
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewPasswordTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		"user@globo.com",
+		"p&ss=word",
+		"read write",
+	)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.TokenType, check.Equals, "Bearer")
+	c.Assert(token.isValid(), check.Equals, true)
+}
+
+func (tms *tokenManagerSuite) TestPasswordTokenManagerRetryFail(c *check.C) {
+	var retries int32
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&retries, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	tm := NewPasswordTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		"user",
+		"wrong",
+		"",
+	)
+
+	token, err := tm.GetToken()
+	c.Assert(token, check.IsNil)
+	var httpErr *HTTP
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&retries), check.Equals, int32(DefaultTokenMaxRetries))
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerScopesAndParams(c *check.C) {
+	var grantedScope string
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.PostForm.Get("grant_type"), check.Equals, "client_credentials")
+		c.Assert(r.PostForm.Get("scope"), check.Equals, "read write")
+		c.Assert(r.PostForm.Get("audience"), check.Equals, "https://api.globo.com/?a=1&b=2")
+		c.Assert(r.PostForm["resource"], check.DeepEquals, []string{"urn:one", "urn:two"})
+		if grantedScope == "" {
+			fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 0, "scope": "%s"}`, grantedScope)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.Scopes = []string{"read", "write"}
+	options.Params = url.Values{
+		"audience": {"https://api.globo.com/?a=1&b=2"},
+		"resource": {"urn:one", "urn:two"},
+	}
+
+	tm := NewTokenManager(
+		ts.URL+"/token",
+		"ClientId",
+		"ClientSecret",
+		options,
+	)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.Scopes(), check.DeepEquals, []string{"read", "write"})
+
+	grantedScope = "read"
+	token, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.Scopes(), check.DeepEquals, []string{"read"})
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerClientSecretBasicEncoding(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		c.Assert(ok, check.Equals, true)
+		c.Assert(username, check.Equals, "client%3Aid")
+		c.Assert(password, check.Equals, "s%C3%A9cret+%26%3D%25")
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.EscapeBasicCredentials = true
+	tm := NewTokenManager(ts.URL+"/token", "client:id", "sécret &=%", options)
+
+	_, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerClientSecretBasicRaw(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), check.Equals,
+			"Basic "+base64.StdEncoding.EncodeToString([]byte("client:id:s/cret+=%&")))
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "client:id", "s/cret+=%&")
+
+	_, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerClientSecretPost(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "")
+		c.Assert(r.PostForm.Get("grant_type"), check.Equals, "client_credentials")
+		c.Assert(r.PostForm.Get("client_id"), check.Equals, "client:id")
+		c.Assert(r.PostForm.Get("client_secret"), check.Equals, "sécret &=%+")
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.AuthMethod = ClientSecretPost
+
+	tm := NewTokenManager(ts.URL+"/token", "client:id", "sécret &=%+", options)
+	c.Assert(tm.Authorization, check.Equals, "")
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.isValid(), check.Equals, true)
+}
+
+func handlePrivateKeyJWTToken(c *check.C, pub crypto.PublicKey, jtis *[]string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "")
+		c.Assert(r.PostForm.Get("client_assertion_type"), check.Equals, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+
+		parts := strings.Split(r.PostForm.Get("client_assertion"), ".")
+		c.Assert(parts, check.HasLen, 3)
+
+		var header jwtHeader
+		var claims jwtClaims
+		rawHeader, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		rawClaims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		c.Assert(json.Unmarshal(rawHeader, &header), check.IsNil)
+		c.Assert(json.Unmarshal(rawClaims, &claims), check.IsNil)
+
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		switch key := pub.(type) {
+		case *rsa.PublicKey:
+			c.Assert(header.Algorithm, check.Equals, "RS256")
+			c.Assert(rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature), check.IsNil)
+		case *ecdsa.PublicKey:
+			c.Assert(header.Algorithm, check.Equals, "ES256")
+			c.Assert(signature, check.HasLen, 64)
+			rs, ss := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			c.Assert(ecdsa.Verify(key, digest[:], rs, ss), check.Equals, true)
+		}
+
+		c.Assert(header.KeyID, check.Equals, "key-1")
+		c.Assert(claims.Issuer, check.Equals, "ClientId")
+		c.Assert(claims.Subject, check.Equals, "ClientId")
+		c.Assert(claims.Audience, check.Equals, "http://"+r.Host+"/token")
+		c.Assert(claims.ExpiresAt > time.Now().Unix(), check.Equals, true)
+
+		*jtis = append(*jtis, claims.ID)
+		if len(*jtis) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	}
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerPrivateKeyJWT(c *check.C) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, check.IsNil)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		var jtis []string
+		ts := newTestServerCustom(handlePrivateKeyJWTToken(c, key.Public(), &jtis))
+
+		options := defaultTokenOptions
+		options.AuthMethod = PrivateKeyJWT
+		options.PrivateKey = key
+		options.KeyID = "key-1"
+
+		tm := NewTokenManager(ts.URL+"/token", "ClientId", "", options)
+
+		token, err := tm.GetToken()
+		c.Assert(err, check.IsNil)
+		c.Assert(token.isValid(), check.Equals, true)
+		c.Assert(jtis, check.HasLen, 2)
+		c.Assert(jtis[0], check.Not(check.Equals), jtis[1])
+
+		ts.Close()
+	}
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerPrivateKeyJWTWithoutKey(c *check.C) {
+	options := defaultTokenOptions
+	options.AuthMethod = PrivateKeyJWT
+
+	tm := NewTokenManager("http://localhost/token", "ClientId", "", options)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.ErrorMatches, "PrivateKey is required .*")
+	c.Assert(token, check.IsNil)
+}
+
+func handleMutualTLSToken(c *check.C, thumbprint *string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.ParseForm(), check.IsNil)
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "")
+		c.Assert(r.PostForm.Get("client_id"), check.Equals, "ClientId")
+		c.Assert(r.TLS.PeerCertificates, check.HasLen, 1)
+
+		if *thumbprint == "" {
+			sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+			*thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+		}
+		fmt.Fprintf(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100, "cnf": {"x5t#S256": "%s"}}`, *thumbprint)
+	}
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerMutualTLS(c *check.C) {
+	var thumbprint string
+	ts := newTestServerTLS(handleMutualTLSToken(c, &thumbprint))
+	defer ts.Close()
+
+	cert, err := newTestClientCertificate()
+	c.Assert(err, check.IsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	options := defaultTokenOptions
+	options.AuthMethod = TLSClientAuth
+	options.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "", options)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token.CertificateThumbprint(), check.Equals, thumbprint)
+	c.Assert(token.CertificateThumbprint(), check.Equals, certificateThumbprint(cert))
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerMutualTLSBoundToAnotherCertificate(c *check.C) {
+	thumbprint := "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"
+	ts := newTestServerTLS(handleMutualTLSToken(c, &thumbprint))
+	defer ts.Close()
+
+	cert, err := newTestClientCertificate()
+	c.Assert(err, check.IsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	options := defaultTokenOptions
+	options.AuthMethod = TLSClientAuth
+	options.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "", options)
+
+	token, err := tm.GetToken()
+	c.Assert(err, check.ErrorMatches, "Token is bound to certificate .*")
+	c.Assert(token, check.IsNil)
+}
+
+type countingTransport struct {
+	requests  int32
+	transport http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return t.transport.RoundTrip(req)
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerReusesConnections(c *check.C) {
+	var connections int32
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(handleToken(0)))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+	for i := 0; i < 3; i++ {
+		_, err := tm.GetToken()
+		c.Assert(err, check.IsNil)
+	}
+
+	c.Assert(atomic.LoadInt32(&connections), check.Equals, int32(1))
+}
+
+func (tms *tokenManagerSuite) TestTokenManagerInjectedTransport(c *check.C) {
+	ts := newTestServerCustom(handleToken(100))
+	defer ts.Close()
+
+	transport := &countingTransport{transport: http.DefaultTransport}
+
+	options := defaultTokenOptions
+	options.Transport = transport
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	_, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&transport.requests), check.Equals, int32(1))
+
+	options = defaultTokenOptions
+	options.HTTPClient = &http.Client{Transport: transport}
+	tm = NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	_, err = tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&transport.requests), check.Equals, int32(2))
+}
+
+func (tms *tokenManagerSuite) TestGetTokenSingleFlight(c *check.C) {
+	var requests int32
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+
+	var wg sync.WaitGroup
+	tokens := make(chan *Token, 10)
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tm.GetToken()
+			c.Assert(err, check.IsNil)
+			tokens <- token
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+
+	first := <-tokens
+	for token := range tokens {
+		c.Assert(token, check.Equals, first)
+	}
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+
+	// a valid token is served while a refresh is in flight
+	go func() { _, _ = tm.refresh(context.Background(), true) }()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	token, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, first)
+	c.Assert(time.Since(start) < 100*time.Millisecond, check.Equals, true)
+}
+
+func (tms *tokenManagerSuite) TestRefreshRechecksStoredToken(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"access_token": "nonenoenoe", "token_type": "bearer", "expires_in": 100}`)
+	})
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+	first, err := tm.GetToken()
+	c.Assert(err, check.IsNil)
+
+	// a caller that missed the token before locking gets it without a new fetch
+	token, err := tm.refresh(context.Background(), false)
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, first)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+
+	token, err = tm.refresh(context.Background(), true)
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Not(check.Equals), first)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}
+
+func (tms *tokenManagerSuite) TestGetTokenSingleFlightSharesError(c *check.C) {
+	var requests int32
+
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+
+	var wg sync.WaitGroup
+	for n := 0; n < 5; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tm.GetToken()
+			c.Assert(err, check.ErrorMatches, "Failed to request token .*")
+			c.Assert(token, check.IsNil)
+		}()
+	}
+	wg.Wait()
+
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(DefaultTokenMaxRetries))
+}
+
+func (tms *tokenManagerSuite) TestGetTokenContextCanceled(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.Timeout = 5 * time.Second
+	options.Backoff = ExponentialBackoff
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	token, err := tm.GetTokenContext(ctx)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(token, check.IsNil)
+	c.Assert(time.Since(start) < 500*time.Millisecond, check.Equals, true)
+
+	// waiters whose own context is alive are not failed by a canceled fetch
+	ts2 := newTestServerCustom(handleToken(100))
+	defer ts2.Close()
+	tm.TokenEndPoint = ts2.URL + "/token"
+
+	token, err = tm.GetTokenContext(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(token.isValid(), check.Equals, true)
+}
+
+func (tms *tokenManagerSuite) TestGetTokenContextCanceledDuringBackoff(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.Backoff = ExponentialBackoff
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tm.GetTokenContext(ctx)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
+
+func handleOAuthError(requests *int32, statusCode int, body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, body)
+	}
+}
+
+func (tms *tokenManagerSuite) TestOAuthErrorNotRetried(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleOAuthError(&requests, http.StatusUnauthorized,
+		`{"error": "invalid_client", "error_description": "Client authentication failed", "error_uri": "https://example.com/errors"}`))
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "wrong")
+	token, err := tm.GetToken()
+	c.Assert(token, check.IsNil)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+	c.Assert(err, check.ErrorMatches, "Failed to request token url: .* - statusCode: 401 - OAuth error: invalid_client - Client authentication failed")
+
+	var oauthErr *OAuthError
+	c.Assert(errors.As(err, &oauthErr), check.Equals, true)
+	c.Assert(oauthErr.Code, check.Equals, OAuthInvalidClient)
+	c.Assert(oauthErr.Description, check.Equals, "Client authentication failed")
+	c.Assert(oauthErr.URI, check.Equals, "https://example.com/errors")
+	c.Assert(oauthErr.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(oauthErr.Permanent(), check.Equals, true)
+}
+
+func (tms *tokenManagerSuite) TestOAuthTemporaryErrorRetried(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(handleOAuthError(&requests, http.StatusServiceUnavailable, `{"error": "temporarily_unavailable"}`))
+	defer ts.Close()
+
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret")
+	_, err := tm.GetToken()
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(DefaultTokenMaxRetries))
+
+	var oauthErr *OAuthError
+	c.Assert(errors.As(err, &oauthErr), check.Equals, true)
+	c.Assert(oauthErr.Code, check.Equals, OAuthTemporarilyUnavailable)
+	c.Assert(oauthErr.Permanent(), check.Equals, false)
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.StatusCode, check.Equals, http.StatusServiceUnavailable)
+}
+
+func (tms *tokenManagerSuite) TestOAuthRateLimitRetried(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error": "rate_limit_exceeded"}`)
+	})
+	defer ts.Close()
+
+	options := defaultTokenOptions
+	options.MaxRetryAfter = 10 * time.Millisecond
+	tm := NewTokenManager(ts.URL+"/token", "ClientId", "ClientSecret", options)
+	_, err := tm.GetToken()
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(DefaultTokenMaxRetries))
+	c.Assert(isPermanent(err), check.Equals, false)
+
+	var exhausted *RetriesExhaustedError
+	c.Assert(errors.As(err, &exhausted), check.Equals, true)
+	c.Assert(exhausted.RetryAfter, check.Equals, time.Second)
+
+	// a permanent code asking to retry later is retried too
+	endpointErr := &TokenEndpointError{RetryAfter: time.Second, Err: &OAuthError{Code: OAuthInvalidClient, StatusCode: http.StatusUnauthorized}}
+	c.Assert(isPermanent(endpointErr), check.Equals, false)
+}
+
+func (tms *tokenManagerSuite) TestOAuthErrorPermanence(c *check.C) {
+	for code, permanent := range map[string]bool{
+		OAuthInvalidRequest:         true,
+		OAuthInvalidClient:          true,
+		OAuthInvalidGrant:           true,
+		OAuthUnauthorizedClient:     true,
+		OAuthUnsupportedGrantType:   true,
+		OAuthInvalidScope:           true,
+		OAuthServerError:            false,
+		OAuthTemporarilyUnavailable: false,
+	} {
+		oauthErr := &OAuthError{Code: code, StatusCode: http.StatusBadRequest}
+		c.Assert(oauthErr.Permanent(), check.Equals, permanent, check.Commentf(code))
+	}
+
+	c.Assert((&OAuthError{Code: "custom", StatusCode: http.StatusBadGateway}).Permanent(), check.Equals, false)
+	c.Assert((&OAuthError{Code: "custom", StatusCode: http.StatusBadRequest}).Permanent(), check.Equals, false)
+	c.Assert((&OAuthError{Code: OAuthInvalidRequest, StatusCode: http.StatusTooManyRequests}).Permanent(), check.Equals, false)
+	c.Assert(parseOAuthError(http.StatusBadRequest, []byte(`{"message": "invalid"}`)), check.IsNil)
+	c.Assert(parseOAuthError(http.StatusBadRequest, []byte(`<html></html>`)), check.IsNil)
+}
+
 func (tms *tokenManagerSuite) BenchmarkTokenManagerConcurrencyCalls(c *check.C) {
 	var expire = 100
 
@@ -9,6 +9,7 @@
 package galf
 
 import (
+	"encoding/base64"
 	"strings"
 	"time"
 
@@ -50,3 +51,63 @@ func (s *tokenSuite) TestTokenNotIsValid(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(token.isValid(), check.Equals, false)
 }
+
+func (s *tokenSuite) TestTokenExpiresOnAndTTL(c *check.C) {
+	bodyToken := strings.NewReader(
+		`{"access_token": "nonenone", "token_type": "bearer", "expires_in": 60}`,
+	)
+	token, err := newToken(bodyToken)
+
+	c.Assert(err, check.IsNil)
+	c.Assert(token.ExpiresOn().After(time.Now().Add(59*time.Second)), check.Equals, true)
+	c.Assert(token.TTL() > 59*time.Second, check.Equals, true)
+	c.Assert(token.TTL() <= 60*time.Second, check.Equals, true)
+	c.Assert(token.isValidFor(30*time.Second), check.Equals, true)
+	c.Assert(token.isValidFor(90*time.Second), check.Equals, false)
+}
+
+func (s *tokenSuite) TestTokenTTLExpired(c *check.C) {
+	bodyToken := strings.NewReader(
+		`{"access_token": "nonenone", "token_type": "bearer", "expires_in": 0}`,
+	)
+	token, err := newToken(bodyToken)
+
+	c.Assert(err, check.IsNil)
+	c.Assert(token.TTL(), check.Equals, time.Duration(0))
+}
+
+func (s *tokenSuite) TestTokenScopes(c *check.C) {
+	bodyToken := strings.NewReader(
+		`{"access_token": "nonenone", "token_type": "bearer", "expires_in": 1, "scope": "read  write"}`,
+	)
+	token, err := newToken(bodyToken)
+
+	c.Assert(err, check.IsNil)
+	c.Assert(token.Scope, check.Equals, "read  write")
+	c.Assert(token.Scopes(), check.DeepEquals, []string{"read", "write"})
+}
+
+func (s *tokenSuite) TestTokenCertificateThumbprint(c *check.C) {
+	bodyToken := strings.NewReader(
+		`{"access_token": "nonenone", "token_type": "bearer", "expires_in": 1, "cnf": {"x5t#S256": "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"}}`,
+	)
+	token, err := newToken(bodyToken)
+
+	c.Assert(err, check.IsNil)
+	c.Assert(token.CertificateThumbprint(), check.Equals, "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2")
+}
+
+func (s *tokenSuite) TestTokenCertificateThumbprintFromJWT(c *check.C) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub": "client", "cnf": {"x5t#S256": "thumbprint"}}`))
+	bodyToken := strings.NewReader(
+		`{"access_token": "eyJhbGciOiJSUzI1NiJ9.` + payload + `.c2ln", "token_type": "bearer", "expires_in": 1}`,
+	)
+	token, err := newToken(bodyToken)
+
+	c.Assert(err, check.IsNil)
+	c.Assert(token.CertificateThumbprint(), check.Equals, "thumbprint")
+
+	token, err = newToken(strings.NewReader(`{"access_token": "nonenone", "token_type": "bearer", "expires_in": 1}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(token.CertificateThumbprint(), check.Equals, "")
+}
@@ -0,0 +1,81 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	// Transport is an http.RoundTripper that authorizes requests with tokens
+	// from a TokenManager, renewing the token and replaying the request on 401
+	// as the Client does. It lets SDKs that accept an *http.Client use galf.
+	Transport struct {
+		Base   http.RoundTripper
+		client *Client
+	}
+)
+
+// NewTransport wraps base, or http.DefaultTransport when nil; the retries,
+// backoff and circuit breaker come from options, with the defaults of
+// NewClient when MaxRetries or Backoff are missing. Timeout bounds each
+// attempt, reading its response body included, and ShowDebug logs each attempt.
+func NewTransport(base http.RoundTripper, tokenManager TokenManager, options ...ClientOptions) *Transport {
+	clientOptions := defaultClientOptions
+	if len(options) > 0 {
+		clientOptions = options[0]
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if clientOptions.MaxRetries <= 0 {
+		clientOptions.MaxRetries = defaultClientOptions.MaxRetries
+	}
+	if clientOptions.Backoff == nil {
+		clientOptions.Backoff = defaultClientOptions.Backoff
+	}
+	// a RoundTripper must return the response whatever its status
+	clientOptions.ErrorStatuses = nil
+
+	// only execute is used, so neither the goreq nor the net/http client is built
+	return &Transport{
+		Base:   base,
+		client: &Client{TokenManager: tokenManager, Options: clientOptions},
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := t.client.withTotalTimeout(req.Context())
+	resp, err := t.client.execute(ctx, req.Method, nil, func(ctx context.Context, token *Token) (*http.Response, error) {
+		ctx, cancel := t.withAttemptTimeout(ctx)
+		attempt := newAttemptRequest(ctx, req, body)
+		attempt.Header.Set("Authorization", token.Authorization)
+
+		if t.client.Options.ShowDebug {
+			dumpRequest(attempt)
+		}
+		resp, err := t.Base.RoundTrip(attempt)
+		return cancelOnClose(resp, err, cancel)
+	})
+	return cancelOnClose(resp, err, cancel)
+}
+
+func (t *Transport) withAttemptTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.client.Options.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, t.client.Options.Timeout)
+}
@@ -0,0 +1,168 @@
+/*
+* Go OAuth2 Client
+*
+* MIT License
+*
+* Copyright (c) 2015 Globo.com
+ */
+
+package galf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type transportSuite struct{}
+
+var _ = check.Suite(&transportSuite{})
+
+type countingTokenManager struct {
+	requests int32
+	resets   int32
+}
+
+func (tm *countingTokenManager) GetToken() (*Token, error) {
+	n := atomic.AddInt32(&tm.requests, 1)
+	return &Token{Authorization: fmt.Sprintf("Bearer token-%d", n)}, nil
+}
+
+func (tm *countingTokenManager) ResetToken() {
+	atomic.AddInt32(&tm.resets, 1)
+}
+
+func (s *transportSuite) TestTransportInjectsToken(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), check.Equals, "Bearer token-1")
+		c.Assert(r.Header.Get("Accept"), check.Equals, "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"transport": "OK"}`)
+	})
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	httpClient := &http.Client{Transport: NewTransport(nil, tm)}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/transport/feed/1", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), check.Equals, `{"transport": "OK"}`)
+	c.Assert(req.Header.Get("Authorization"), check.Equals, "")
+}
+
+func (s *transportSuite) TestTransportReplaysOnUnauthorized(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Assert(string(body), check.Equals, `{"body": "test"}`)
+
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	httpClient := &http.Client{Transport: NewTransport(http.DefaultTransport, tm)}
+
+	resp, err := httpClient.Post(ts.URL+"/transport/feed/1", "application/json", strings.NewReader(`{"body": "test"}`))
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusCreated)
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(1))
+}
+
+func (s *transportSuite) TestTransportGivesUpAfterMaxRetries(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	options := defaultClientOptions
+	options.MaxRetries = 3
+
+	tm := &countingTokenManager{}
+	httpClient := &http.Client{Transport: NewTransport(nil, tm, options)}
+
+	resp, err := httpClient.Get(ts.URL + "/transport/feed/1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(2))
+}
+
+func (s *transportSuite) TestTransportZeroOptions(c *check.C) {
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	httpClient := &http.Client{Transport: NewTransport(nil, &countingTokenManager{}, ClientOptions{})}
+
+	resp, err := httpClient.Get(ts.URL + "/transport/feed/1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+}
+
+func (s *transportSuite) TestTransportPartialOptions(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	tm := &countingTokenManager{}
+	httpClient := &http.Client{Transport: NewTransport(nil, tm, ClientOptions{Timeout: 5 * time.Second})}
+
+	resp, err := httpClient.Get(ts.URL + "/transport/feed/1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(DefaultClientMaxRetries))
+	c.Assert(atomic.LoadInt32(&tm.resets), check.Equals, int32(DefaultClientMaxRetries-1))
+}
+
+func (s *transportSuite) TestTransportTimeoutBoundsEachAttempt(c *check.C) {
+	var requests int32
+	ts := newTestServerCustom(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"transport": "OK"}`)
+	})
+	defer ts.Close()
+
+	options := defaultClientOptions
+	options.Timeout = 100 * time.Millisecond
+	options.RetryPolicy = NewRetryPolicy()
+	httpClient := &http.Client{Transport: NewTransport(nil, &countingTokenManager{}, options)}
+
+	start := time.Now()
+	resp, err := httpClient.Get(ts.URL + "/transport/feed/1")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(time.Since(start) < 300*time.Millisecond, check.Equals, true)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, `{"transport": "OK"}`)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(2))
+}